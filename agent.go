@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/components"
+	"github.com/worldsayshi/cir/internal/hooks"
+	"github.com/worldsayshi/cir/internal/state"
+	"github.com/worldsayshi/cir/internal/tools"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+const runCommandToolName = "run_command"
+
+// Commands with these characters can chain or redirect, so they are never auto approved
+const shellMetaCharacters = ";&|`$<>()\n"
+
+// autoApproves tells whether the policy lets a command run without asking the user
+func autoApproves(policy types.ApprovalPolicy, command string) bool {
+	if policy.Mode != types.ApprovalAllowlist {
+		return false
+	}
+	command = strings.TrimSpace(command)
+	if strings.ContainsAny(command, shellMetaCharacters) {
+		return false
+	}
+	for _, prefix := range policy.AllowedPrefixes {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			continue
+		}
+		if command == prefix || strings.HasPrefix(command, prefix+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tab) agentEnabled() bool {
+	return t.workingSession.Agent != nil && t.workingSession.Agent.Enabled
+}
+
+// Expose the run_command tool iff agent mode is on
+func (t *tab) syncAgentTools() {
+	if t.agentEnabled() {
+		t.toolRegistry.Register(tools.Tool{
+			Name:        runCommandToolName,
+			Description: "Propose a shell command, such as running tests or a build. The user approves, edits or rejects it before it runs.",
+			Parameters:  tools.RunCommandParameters,
+			Run:         t.runCommandTool,
+		})
+	} else {
+		t.toolRegistry.Unregister(runCommandToolName)
+	}
+	t.renderInputTitle()
+}
+
+func (t *tab) toggleAgentMode() {
+	t.state.Dispatch(state.AgentToggled{})
+	t.saveSession()
+}
+
+// askCommandApproval shows the approval dialog and blocks until the user decides.
+// Must not be called from the UI goroutine.
+func (t *tab) askCommandApproval(command string) (string, bool) {
+	type decision struct {
+		command  string
+		approved bool
+	}
+	decisionChan := make(chan decision)
+	app := t.app
+	app.QueueUpdateDraw(func() {
+		// Show the tab that asks, it may be running in the background
+		if i := app.tabIndexOf(t.sessionFile); i >= 0 {
+			app.activateTab(i)
+		}
+		previousFocus := app.GetFocus()
+		dialog := components.NewCommandApprovalDialog(command, func(command string, approved bool) {
+			app.pages.RemovePage("approval")
+			app.SetFocus(previousFocus)
+			go func() { decisionChan <- decision{command, approved} }()
+		})
+		app.pages.AddPage("approval", components.Centered(dialog, 80, 7), true, true)
+		app.SetFocus(dialog)
+	})
+	d := <-decisionChan
+	return d.command, d.approved
+}
+
+func (t *tab) runCommandTool(sandbox *tools.Sandbox, rawArgs json.RawMessage) (string, error) {
+	var args struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Command) == "" {
+		return "", fmt.Errorf("command is required")
+	}
+
+	entry := types.CommandDecision{
+		Time:            time.Now(),
+		ProposedCommand: args.Command,
+	}
+	command := args.Command
+	// Tools run on the streaming goroutine
+	var policy types.ApprovalPolicy
+	hookPayload := hooks.Payload{}
+	t.update(func() {
+		policy = t.workingSession.Agent.ApprovalPolicy
+		hookPayload.SessionFile = t.sessionFile
+		hookPayload.Question = lastQuestion(t.workingSession.Messages)
+	})
+	if autoApproves(policy, command) {
+		entry.Decision = types.DecisionAutoApproved
+	} else {
+		var approved bool
+		command, approved = t.askCommandApproval(args.Command)
+		switch {
+		case !approved:
+			entry.Decision = types.DecisionRejected
+		case command != args.Command:
+			entry.Decision = types.DecisionEdited
+		default:
+			entry.Decision = types.DecisionApproved
+		}
+	}
+
+	if entry.Decision == types.DecisionRejected {
+		t.logCommandDecision(entry)
+		return "The user rejected the command.", nil
+	}
+
+	entry.Command = command
+	output, exitCode, err := tools.RunCommand(sandbox, command)
+	entry.ExitCode = &exitCode
+	t.logCommandDecision(entry)
+	if err != nil {
+		return "", err
+	}
+	// The command may have changed files
+	hookPayload.Command = command
+	hookPayload.Output = output
+	output = t.runEditAppliedHooks(hookPayload)
+	result := tools.FormatCommandResult(output, exitCode)
+	if entry.Decision == types.DecisionEdited {
+		result = fmt.Sprintf("The user edited the command to: %s\n%s", command, result)
+	}
+	return result, nil
+}
+
+func (t *tab) logCommandDecision(entry types.CommandDecision) {
+	log.Printf("Command %q: %s", entry.ProposedCommand, entry.Decision)
+	t.update(func() {
+		t.state.Dispatch(state.CommandLogged{Entry: entry})
+		if err := t.save(); err != nil {
+			log.Println("Error saving session:", err)
+		}
+	})
+}
+
+// The last question asked in messages, empty if there is none
+func lastQuestion(messages []types.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == types.RoleUser {
+			return messages[i].Question
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/hooks"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func TestAutoApproves(t *testing.T) {
+	allowlist := types.ApprovalPolicy{
+		Mode:            types.ApprovalAllowlist,
+		AllowedPrefixes: []string{"go test", "go build", "make"},
+	}
+	cases := []struct {
+		policy   types.ApprovalPolicy
+		command  string
+		expected bool
+	}{
+		{allowlist, "go test ./...", true},
+		{allowlist, "go build", true},
+		{allowlist, "  make  ", true},
+		{allowlist, "maker", false},
+		{allowlist, "go vet ./...", false},
+		{allowlist, "go test ./... && rm -rf ~", false},
+		{allowlist, "go test $(rm -rf ~)", false},
+		{allowlist, "go test > out.txt", false},
+		{types.ApprovalPolicy{Mode: types.ApprovalAlwaysAsk, AllowedPrefixes: []string{"go test"}}, "go test ./...", false},
+	}
+	for _, c := range cases {
+		if got := autoApproves(c.policy, c.command); got != c.expected {
+			t.Errorf("autoApproves(%v, %q) = %v, expected %v", c.policy, c.command, got, c.expected)
+		}
+	}
+}
+
+func TestEditAppliedHook(t *testing.T) {
+	config := &Config{Hooks: hooks.Config{OnEditApplied: []hooks.Hook{
+		{Command: "bash", Args: []string{"-c", `grep -q '"command":"echo changed"' && { echo 'go vet failed' >&2; exit 1; }; exit 0`}},
+	}}}
+	app := NewCirApplication(&yamlStore{}, filepath.Join(t.TempDir(), "session.yaml"), config, nil)
+	app.workingSession.Agent = &types.AgentSettings{
+		Enabled:        true,
+		ApprovalPolicy: types.ApprovalPolicy{Mode: types.ApprovalAllowlist, AllowedPrefixes: []string{"echo"}},
+	}
+	startApp(t, app)
+
+	run := func(command string) string {
+		args, _ := json.Marshal(map[string]string{"command": command})
+		result, err := app.tab.runCommandTool(app.toolRegistry.Sandbox(), args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	if result := run("echo unchanged"); strings.Contains(result, "objected") {
+		t.Fatalf("Expected the hook to let the command through, got %q", result)
+	}
+	// The model is told what the hook found
+	if result := run("echo changed"); !strings.Contains(result, "changed\nA hook objected to the changes: go vet failed") {
+		t.Fatalf("Expected the veto in the result, got %q", result)
+	}
+}
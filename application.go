@@ -8,21 +8,33 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/worldsayshi/cir/internal/components"
+	"github.com/worldsayshi/cir/internal/mcp"
+	"github.com/worldsayshi/cir/internal/plugins"
 	"github.com/worldsayshi/cir/internal/types"
 )
 
 type CirApplication struct {
 	*tview.Application
-	chatHistory    *tview.TextView
-	inputArea      *components.InputArea
-	contextBar     *components.ContextBar
-	workingSession *types.WorkingSession
-	sessionFile    string
+	*tab        // The active tab
+	tabs        []*tab
+	nextTabID   int
+	tabBar      *components.TabBar
+	statusBar   *tview.TextView
+	tabPages    *tview.Pages
+	pages       *tview.Pages
+	keyBindings []keyBinding
+	plugins     []boundPlugin
+	sessionsDir string
+	store       SessionStore
+	config      *Config
+	spend       *spendTracker
+	mcpClients  map[string]*mcp.Client
 }
 
 // From: https://github.com/rivo/tview/issues/100#issuecomment-763131391
@@ -64,57 +76,41 @@ func (cirApp *CirApplication) editContextFiles() {
 			selectedWorkingFiles = append(selectedWorkingFiles, types.WorkingFile{Path: f})
 		}
 	}
-	cirApp.workingSession.WorkingFiles = selectedWorkingFiles
-	if err := saveWorkingSession(cirApp.sessionFile, cirApp.workingSession); err != nil {
-		panic(err)
+	// MCP resources and plugin output are managed separately, keep them
+	for _, wf := range cirApp.workingSession.WorkingFiles {
+		if wf.McpServer != "" || wf.InlineContent != "" {
+			selectedWorkingFiles = append(selectedWorkingFiles, wf)
+		}
 	}
-	cirApp.contextBar.Render(cirApp.workingSession.WorkingFiles)
+	cirApp.setWorkingFiles(selectedWorkingFiles)
 }
 
-func NewCirApplication(sessionFile string) *CirApplication {
-	workingSession, err := loadWorkingSession(sessionFile)
-	if err != nil {
-		log.Println("Error loading session from file:", sessionFile)
-		panic(fmt.Sprintf("Error loading session from file: %v\n%v", sessionFile, err))
-	}
-
-	// Chat history
-	chatHistory := components.InitChatHistory(workingSession)
-
-	// Context bar
-	contextBar := components.NewContextBar(&workingSession.WorkingFiles)
-
-	// Text input area
-	inputArea := components.NewInputArea()
-
+func NewCirApplication(store SessionStore, sessionFile string, config *Config, spend *spendTracker) *CirApplication {
 	cirApp := &CirApplication{
-		Application:    tview.NewApplication(),
-		chatHistory:    chatHistory,
-		inputArea:      inputArea,
-		contextBar:     contextBar,
-		workingSession: workingSession,
-		sessionFile:    sessionFile,
+		Application: tview.NewApplication(),
+		tabBar:      components.NewTabBar(),
+		statusBar:   tview.NewTextView().SetDynamicColors(true),
+		tabPages:    tview.NewPages(),
+		pages:       tview.NewPages(),
+		sessionsDir: filepath.Dir(sessionFile),
+		store:       store,
+		config:      config,
+		spend:       spend,
+		mcpClients:  startMCPServers(config.MCPServers),
+	}
+	cirApp.keyBindings = cirApp.newKeyBindings()
+	cirApp.registerPlugins(config.Plugins)
+	if err := cirApp.openTab(sessionFile); err != nil {
+		log.Println("Error loading session from file:", sessionFile)
+		panic(err)
 	}
 
-	// Redraw chat history when it changes
-	chatHistory.SetChangedFunc(func() {
-		cirApp.Draw()
-	})
-
-	inputArea.SetInputText(workingSession.InputText)
-
-	// Update input text in working session
-	inputArea.SetChangedFunc(func() {
-		cirApp.workingSession.InputText = inputArea.GetText()
-	})
-
-	inputArea.SetSubmitFunc(cirApp.handleChatSubmit)
-	cirApp.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		return event
-	})
-
-	focusableElements := []tview.Primitive{chatHistory, inputArea}
 	cirApp.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Leave key handling to modal dialogs while they are open
+		if cirApp.modalOpen() {
+			return event
+		}
+		focusableElements := []tview.Primitive{cirApp.chatHistory, cirApp.inputArea}
 		switch event.Key() {
 		// Tab and Shift+Tab to cycle focus
 		case tcell.KeyTab:
@@ -123,9 +119,28 @@ func NewCirApplication(sessionFile string) *CirApplication {
 		case tcell.KeyBacktab:
 			cirApp.cycleFocus(focusableElements, true)
 			return nil
-		// Ctrl+O to edit context files
-		case tcell.KeyCtrlO:
-			cirApp.editContextFiles()
+		}
+		for _, binding := range cirApp.keyBindings {
+			if binding.key.Matches(event) {
+				binding.action()
+				return nil
+			}
+		}
+		// Alt+Left/Right and Alt+1..9 to switch tabs
+		if event.Modifiers()&tcell.ModAlt != 0 {
+			switch {
+			case event.Key() == tcell.KeyLeft:
+				cirApp.cycleTabs(-1)
+				return nil
+			case event.Key() == tcell.KeyRight:
+				cirApp.cycleTabs(1)
+				return nil
+			case event.Key() == tcell.KeyRune && event.Rune() >= '1' && event.Rune() <= '9':
+				cirApp.activateTab(int(event.Rune() - '1'))
+				return nil
+			}
+		}
+		if cirApp.runPluginFor(event) {
 			return nil
 		}
 		return event
@@ -134,29 +149,91 @@ func NewCirApplication(sessionFile string) *CirApplication {
 	return cirApp
 }
 
+// A global key binding
+type keyBinding struct {
+	key plugins.Key
+	// What the key does, for plugins that would take it
+	name   string
+	action func()
+}
+
+func ctrlKey(key tcell.Key) plugins.Key {
+	return plugins.Key{Key: key}
+}
+
+func altKey(r rune) plugins.Key {
+	return plugins.Key{Key: tcell.KeyRune, Rune: r, Modifiers: tcell.ModAlt}
+}
+
+// The keys the input area uses for editing, like Ctrl-X to cut or Ctrl-W to delete a
+// word, are left to it. The bindings that would take them use Alt instead. The
+// actions go through cirApp.tab at the time of the key press, the active tab.
+func (cirApp *CirApplication) newKeyBindings() []keyBinding {
+	return []keyBinding{
+		// Ctrl+O to edit context files
+		{ctrlKey(tcell.KeyCtrlO), "editing context files", func() { cirApp.editContextFiles() }},
+		// Ctrl+R to attach MCP resources or insert MCP prompts
+		{ctrlKey(tcell.KeyCtrlR), "attaching MCP resources", func() { cirApp.openMCPPicker() }},
+		// Ctrl+G to toggle agent mode
+		{ctrlKey(tcell.KeyCtrlG), "toggling agent mode", func() { cirApp.toggleAgentMode() }},
+		// Ctrl+P to submit to several models and compare their answers
+		{ctrlKey(tcell.KeyCtrlP), "comparing models", func() { cirApp.submitComparison() }},
+		// Ctrl+T to open a session in a new tab
+		{ctrlKey(tcell.KeyCtrlT), "opening a tab", func() { cirApp.promptNewTab() }},
+		// Alt+S to browse and switch sessions
+		{altKey('s'), "browsing sessions", func() { cirApp.openSessionBrowser() }},
+		// Alt+/ to search all sessions
+		{altKey('/'), "searching sessions", func() { cirApp.openSearch() }},
+		// Alt+R to regenerate the last answer
+		{altKey('r'), "regenerating answers", func() { cirApp.openRegenerateDialog() }},
+		// Alt+X to stop the answer streaming in the current tab
+		{altKey('x'), "stopping answers", func() { cirApp.stopStreaming() }},
+		// Alt+W to close the current tab
+		{altKey('w'), "closing the tab", func() { cirApp.closeTab() }},
+	}
+}
+
+func (cirApp *CirApplication) modalOpen() bool {
+	name, _ := cirApp.pages.GetFrontPage()
+	return name != "" && name != "main"
+}
+
 func (cirApp *CirApplication) Run() error {
 	flex := tview.NewFlex().SetDirection(tview.FlexRow).
-		AddItem(cirApp.chatHistory, 0, 5, false).
-		AddItem(cirApp.contextBar, 0, 1, false).
-		AddItem(cirApp.inputArea, 0, 2, true)
+		AddItem(cirApp.tabBar, 1, 0, false).
+		AddItem(cirApp.tabPages, 0, 1, true).
+		AddItem(cirApp.statusBar, 1, 0, false)
+	cirApp.pages.AddPage("main", flex, true, true)
+	defer closeMCPClients(cirApp.mcpClients)
+	defer func() {
+		for _, t := range cirApp.tabs {
+			if err := t.save(); err != nil {
+				log.Println("Error saving session:", err)
+			}
+			t.close()
+		}
+	}()
 	if err := cirApp.
-		SetRoot(flex, true).
+		SetRoot(cirApp.pages, true).
 		SetFocus(cirApp.inputArea).Run(); err != nil {
 		panic(err)
 	}
-	defer func() {
-		if err := saveWorkingSession(cirApp.sessionFile, cirApp.workingSession); err != nil {
-			log.Println("Error saving session:", err)
-		}
-	}()
 	return nil
 }
 
+func readLocalFile(wf types.WorkingFile) ([]byte, error) {
+	return os.ReadFile(wf.Path)
+}
+
 // Add WorkingFiles to the content iff checksum is nill or changed
 func getFilesToSubmit(wfs []types.WorkingFile) []types.WorkingFile {
+	return getFilesToSubmitWith(wfs, readLocalFile)
+}
+
+func getFilesToSubmitWith(wfs []types.WorkingFile, readFile func(types.WorkingFile) ([]byte, error)) []types.WorkingFile {
 	filesToSubmit := []types.WorkingFile{}
 	for _, wf := range wfs {
-		fileContents, err := os.ReadFile(wf.Path)
+		fileContents, err := readFile(wf)
 		if err != nil {
 			log.Println("Error reading context file:", wf.Path, err)
 			continue
@@ -196,91 +273,3 @@ func prepareUserMessage(filesToSubmit []types.WorkingFile, question string) stri
 	})
 	return buf.String()
 }
-
-// Update the checksums of the files that were submitted
-func (cirApp *CirApplication) updateWorkingFileChecksums(filesToSubmit []types.WorkingFile) {
-	for i, wf := range cirApp.workingSession.WorkingFiles {
-		for _, wfSubmit := range filesToSubmit {
-			if wf.Path == wfSubmit.Path {
-				cirApp.workingSession.WorkingFiles[i] = wfSubmit
-			}
-		}
-	}
-}
-
-func (cirApp *CirApplication) handleChatSubmit(text string) {
-	if text != "" {
-		filesToSubmit := getFilesToSubmit(cirApp.workingSession.WorkingFiles)
-		content := prepareUserMessage(filesToSubmit, text)
-		cirApp.workingSession.Messages = append(
-			cirApp.workingSession.Messages,
-			types.Message{
-				AiServiceMessage:     types.AiServiceMessage{Role: "user", Content: content},
-				Question:             text,
-				IncludedWorkingFiles: filesToSubmit,
-			})
-		cirApp.updateWorkingFileChecksums(filesToSubmit)
-		components.RenderChatHistory(cirApp.chatHistory, cirApp.workingSession.Messages)
-		cirApp.inputArea.SetText("", true)
-		if err := saveWorkingSession(cirApp.sessionFile, cirApp.workingSession); err != nil {
-			panic(err)
-		}
-
-		// Lock the text input area
-		cirApp.inputArea.SetDisabled(true)
-
-		// Add empty message for streaming response
-		cirApp.workingSession.Messages = append(
-			cirApp.workingSession.Messages,
-			types.Message{
-				AiServiceMessage:     types.AiServiceMessage{Role: "system", Content: ""},
-				Question:             "",
-				IncludedWorkingFiles: []types.WorkingFile{},
-			},
-		)
-		lastIdx := len(cirApp.workingSession.Messages) - 1
-
-		serviceMessages := []types.AiServiceMessage{}
-		for _, msg := range cirApp.workingSession.Messages[:lastIdx] {
-			serviceMessages = append(serviceMessages, msg.AiServiceMessage)
-		}
-
-		// Start streaming
-		resultChan, errChan := streamOpenAI(serviceMessages)
-
-		// Create a goroutine to handle streaming updates
-		go cirApp.handleStreamResponse(resultChan, errChan)
-	}
-}
-
-func (cirApp *CirApplication) handleStreamResponse(resultChan chan string, errChan chan error) {
-	accumulated := ""
-	lastIdx := len(cirApp.workingSession.Messages) - 1
-	for {
-		select {
-		case chunk, ok := <-resultChan:
-			if !ok {
-				// Stream completed
-				if err := saveWorkingSession(cirApp.sessionFile, cirApp.workingSession); err != nil {
-					panic(err)
-				}
-				cirApp.inputArea.SetDisabled(false)
-				return
-			}
-			accumulated += chunk
-			cirApp.workingSession.Messages[lastIdx].AiServiceMessage.Content = accumulated
-			components.RenderChatHistory(cirApp.chatHistory, cirApp.workingSession.Messages)
-		case err := <-errChan:
-			log.Printf("Error: %v", err)
-			if err != nil {
-				cirApp.workingSession.Messages[lastIdx].Content = fmt.Sprintf("Error: %v", err)
-				components.RenderChatHistory(cirApp.chatHistory, cirApp.workingSession.Messages)
-				cirApp.inputArea.SetDisabled(false)
-				if err := saveWorkingSession(cirApp.sessionFile, cirApp.workingSession); err != nil {
-					panic(err)
-				}
-				return
-			}
-		}
-	}
-}
@@ -37,7 +37,7 @@ working_files:
 	defer os.Remove(testFilePath)
 
 	// Initialize CirApplication
-	app := NewCirApplication(tmpSessionfile.Name())
+	app := NewCirApplication(&yamlStore{}, tmpSessionfile.Name(), &Config{}, nil)
 
 	// Prepare user message
 	question := "What is the content of the test file?"
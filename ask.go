@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Name of the context file holding piped input
+const stdinContextPath = "<stdin>"
+
+// Repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func stdinIsPiped() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice == 0
+}
+
+// Add files to the session's working set, like Ctrl+O does in the TUI
+func addWorkingFiles(workingSession *types.WorkingSession, paths []string) error {
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			return err
+		}
+		exists := false
+		for _, wf := range workingSession.WorkingFiles {
+			if wf.Path == p {
+				exists = true
+			}
+		}
+		if !exists {
+			workingSession.WorkingFiles = append(workingSession.WorkingFiles, types.WorkingFile{Path: p})
+		}
+	}
+	return nil
+}
+
+// runAsk implements `cir ask`: send one question, stream the answer to stdout and
+// append the turn to the session
+func runAsk(cirDir string, defaultSessionFile string, defaultConfigFile string, args []string) error {
+	flags := flag.NewFlagSet("ask", flag.ExitOnError)
+	session := flags.String("session", defaultSessionFile, "session name or path")
+	configFile := flags.String("config", defaultConfigFile, "path to the config file")
+	var files stringList
+	flags.Var(&files, "f", "add a file to the session's context, can be repeated")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: cir ask [flags] [question]")
+		fmt.Fprintln(flags.Output(), "Without a question argument, the question is read from stdin. With one, piped stdin is sent as context.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	question := strings.Join(flags.Args(), " ")
+	extraFiles := []types.WorkingFile{}
+	if stdinIsPiped() {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if question == "" {
+			question = string(data)
+		} else if len(data) > 0 {
+			extraFiles = append(extraFiles, types.WorkingFile{Path: stdinContextPath, FileContent: data})
+		}
+	}
+	if strings.TrimSpace(question) == "" {
+		flags.Usage()
+		return fmt.Errorf("no question given")
+	}
+
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	store, err := openSessionStore(cirDir, config)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	mcpClients := startMCPServers(config.MCPServers)
+	defer closeMCPClients(mcpClients)
+	c, err := newChat(store, resolveSessionFile(cirDir, *session), config, mcpClients, newSpendTracker(cirDir, config.Spending))
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	if err := c.spend.checkHeadless(c.sessionFile, os.Stderr); err != nil {
+		return err
+	}
+
+	if err := addWorkingFiles(c.workingSession, files); err != nil {
+		return err
+	}
+
+	findings, err := c.submitQuestion(question, extraFiles)
+	for _, f := range findings {
+		fmt.Fprintln(os.Stderr, "Redacted", f)
+	}
+	if err != nil {
+		return err
+	}
+
+	return printAnswer(c, completionOptions{Model: c.model()})
+}
+
+// Stream the answer to stdout, and the tool calls made along the way to stderr.
+// Ctrl+C stops the answer and keeps what was streamed so far.
+func printAnswer(c *chat, options completionOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	printed := false
+	err := c.streamAnswer(
+		ctx,
+		options,
+		func(chunk string) {
+			printed = true
+			fmt.Print(chunk)
+		},
+		func() {
+			// Show tool calls on stderr so stdout only has the answer
+			messages := c.workingSession.Messages
+			for i := len(messages) - 1; i >= 0; i-- {
+				if len(messages[i].ToolCalls) > 0 {
+					for _, call := range messages[i].ToolCalls {
+						fmt.Fprintf(os.Stderr, "[tool call: %s(%s)]\n", call.Function.Name, call.Function.Arguments)
+					}
+					return
+				}
+			}
+		},
+	)
+	if printed {
+		fmt.Println()
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func TestAddWorkingFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(file, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workingSession := &types.WorkingSession{WorkingFiles: []types.WorkingFile{{Path: file}}}
+
+	if err := addWorkingFiles(workingSession, []string{file}); err != nil {
+		t.Fatal(err)
+	}
+	if len(workingSession.WorkingFiles) != 1 {
+		t.Fatalf("Expected the file to be added once, got %d working files", len(workingSession.WorkingFiles))
+	}
+
+	if err := addWorkingFiles(workingSession, []string{filepath.Join(tmpDir, "missing.go")}); err == nil {
+		t.Fatalf("Expected an error for a missing file")
+	}
+}
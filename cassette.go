@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/worldsayshi/cir/internal/tools"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+const (
+	cassetteRecord   = "record"
+	cassetteReplay   = "replay"
+	replayProvider   = "replay"
+	maxCassetteEvent = 16 * 1024 * 1024
+)
+
+var errNotRecorded = errors.New("no recorded answer")
+
+// One streamed completion in a cassette: what was asked and what came back
+type interaction struct {
+	Model    string                   `json:"model"`
+	Messages []types.AiServiceMessage `json:"messages"`
+	Events   []streamEvent            `json:"events"`
+}
+
+// recorder streams from another provider and appends every completion to a cassette.
+// A cassette has one JSON interaction per line.
+type recorder struct {
+	provider provider
+	path     string
+	mutex    sync.Mutex
+}
+
+func newRecorder(p provider, path string) *recorder {
+	return &recorder{provider: p, path: path}
+}
+
+func (r *recorder) name() string {
+	return r.provider.name()
+}
+
+func (r *recorder) stream(ctx context.Context, options completionOptions, messages []types.AiServiceMessage, toolDefinitions []tools.Definition) (chan string, chan []types.ToolCall, chan types.Usage, chan error) {
+	resultIn, toolCallIn, usageIn, errIn := r.provider.stream(ctx, options, messages, toolDefinitions)
+	resultChan := make(chan string)
+	toolCallChan := make(chan []types.ToolCall)
+	usageChan := make(chan types.Usage, 1)
+	errChan := make(chan error)
+
+	go func() {
+		defer close(resultChan)
+		defer close(toolCallChan)
+		defer close(errChan)
+
+		recorded := interaction{Model: options.Model, Messages: messages}
+		// The usage comes before the end of the stream, where the reader looks for it
+		passUsage := func() {
+			select {
+			case usage := <-usageIn:
+				recorded.Events = append(recorded.Events, streamEvent{Usage: &usage})
+				usageChan <- usage
+			default:
+			}
+		}
+		// Saved before the last event is passed on, the reader may go on to the next
+		// completion right away
+		saved := false
+		save := func() {
+			// A stopped answer isn't what the API would answer
+			if saved || ctx.Err() != nil {
+				return
+			}
+			saved = true
+			if err := r.append(recorded); err != nil {
+				log.Println("Error recording to cassette:", err)
+			}
+		}
+		for resultIn != nil || toolCallIn != nil || errIn != nil {
+			select {
+			case chunk, ok := <-resultIn:
+				if !ok {
+					resultIn = nil
+					continue
+				}
+				recorded.Events = append(recorded.Events, streamEvent{Chunk: chunk})
+				resultChan <- chunk
+			case toolCalls, ok := <-toolCallIn:
+				if !ok {
+					toolCallIn = nil
+					continue
+				}
+				passUsage()
+				recorded.Events = append(recorded.Events, streamEvent{ToolCalls: toolCalls})
+				save()
+				toolCallChan <- toolCalls
+			case err, ok := <-errIn:
+				if !ok {
+					errIn = nil
+					continue
+				}
+				passUsage()
+				recorded.Events = append(recorded.Events, errorEvent(err))
+				save()
+				errChan <- err
+			}
+		}
+		passUsage()
+		save()
+	}()
+
+	return resultChan, toolCallChan, usageChan, errChan
+}
+
+func errorEvent(err error) streamEvent {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return streamEvent{APIError: apiErr}
+	}
+	return streamEvent{Error: err.Error()}
+}
+
+// Append a single line, like the spending ledger
+func (r *recorder) append(recorded interaction) error {
+	data, err := json.Marshal(recorded)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replayer streams the completions of a cassette instead of calling an API. A
+// completion is replayed for the same model and messages it was recorded for, each
+// recording once, in the order they were recorded.
+type replayer struct {
+	path         string
+	interactions []interaction
+	used         []bool
+	mutex        sync.Mutex
+}
+
+func loadReplayer(path string) (*replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening cassette: %w", err)
+	}
+	defer f.Close()
+	r := &replayer{path: path}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxCassetteEvent)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var recorded interaction
+		if err := json.Unmarshal(scanner.Bytes(), &recorded); err != nil {
+			return nil, fmt.Errorf("reading cassette %s line %d: %w", path, line, err)
+		}
+		r.interactions = append(r.interactions, recorded)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+func (r *replayer) name() string {
+	return replayProvider
+}
+
+func (r *replayer) stream(ctx context.Context, options completionOptions, messages []types.AiServiceMessage, toolDefinitions []tools.Definition) (chan string, chan []types.ToolCall, chan types.Usage, chan error) {
+	key, err := json.Marshal(messages)
+	if err != nil {
+		return playEvents(ctx, []streamEvent{{err: err}})
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, recorded := range r.interactions {
+		if r.used[i] || recorded.Model != options.Model {
+			continue
+		}
+		// Compared as JSON, like they were recorded
+		if recordedKey, err := json.Marshal(recorded.Messages); err == nil && bytes.Equal(recordedKey, key) {
+			r.used[i] = true
+			return playEvents(ctx, recorded.Events)
+		}
+	}
+	err = fmt.Errorf("%w for this conversation with %s in %s", errNotRecorded, options.Model, r.path)
+	return playEvents(ctx, []streamEvent{{err: err}})
+}
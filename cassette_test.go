@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Stream a completion from a provider and collect what it sends
+func collectFrom(p provider, model string, question string) (string, []types.ToolCall, *types.Usage, error) {
+	messages := []types.AiServiceMessage{{Role: types.RoleUser, Content: question}}
+	resultChan, toolCallChan, usageChan, errChan := p.stream(context.Background(), completionOptions{Model: model}, messages, nil)
+	content := ""
+	var toolCalls []types.ToolCall
+	var streamErr error
+	for resultChan != nil || toolCallChan != nil || errChan != nil {
+		select {
+		case chunk, ok := <-resultChan:
+			if !ok {
+				resultChan = nil
+				continue
+			}
+			content += chunk
+		case calls, ok := <-toolCallChan:
+			if !ok {
+				toolCallChan = nil
+				continue
+			}
+			toolCalls = calls
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			streamErr = err
+		}
+	}
+	var usage *types.Usage
+	select {
+	case u := <-usageChan:
+		usage = &u
+	default:
+	}
+	return content, toolCalls, usage, streamErr
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "cassette.jsonl")
+	toolCall := types.ToolCall{ID: "call_1", Type: "function"}
+	toolCall.Function.Name = "read_file"
+	toolCall.Function.Arguments = `{"path": "main.go"}`
+	fake := newScripted(
+		chunks("Hello", " there"),
+		[]streamEvent{{ToolCalls: []types.ToolCall{toolCall}}},
+		[]streamEvent{{Chunk: "Partial"}, {err: &apiError{kind: errServer, StatusCode: 503, Message: "overloaded"}}},
+	)
+	recording := newRecorder(fake, cassette)
+	collectFrom(recording, "gpt-4o", "Hi")
+	collectFrom(recording, "gpt-4o", "Read main.go")
+	collectFrom(recording, "gpt-4o", "Hi again")
+
+	replay, err := newProvider(&Config{Cassette: CassetteConfig{Path: cassette}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.name() != replayProvider {
+		t.Fatalf("Expected the replay provider, got %s", replay.name())
+	}
+	content, _, usage, err := collectFrom(replay, "gpt-4o", "Hi")
+	if content != "Hello there" || err != nil {
+		t.Fatalf("Expected the recorded answer, got %q, %v", content, err)
+	}
+	if usage == nil || usage.TotalTokens != 12 {
+		t.Fatalf("Expected the recorded usage, got %v", usage)
+	}
+	_, toolCalls, _, _ := collectFrom(replay, "gpt-4o", "Read main.go")
+	if len(toolCalls) != 1 || toolCalls[0].Function.Arguments != toolCall.Function.Arguments {
+		t.Fatalf("Expected the recorded tool call, got %v", toolCalls)
+	}
+	content, _, _, err = collectFrom(replay, "gpt-4o", "Hi again")
+	if content != "Partial" || !errors.Is(err, errServer) {
+		t.Fatalf("Expected the recorded server error after a chunk, got %q, %v", content, err)
+	}
+
+	// Each recording is replayed once, and only for the same model and messages
+	for _, model := range []string{"gpt-4o", "o1"} {
+		if _, _, _, err := collectFrom(replay, model, "Hi"); !errors.Is(err, errNotRecorded) {
+			t.Fatalf("Expected no recording for %s, got %v", model, err)
+		}
+	}
+}
+
+func TestCassetteConfig(t *testing.T) {
+	if _, err := newProvider(&Config{Cassette: CassetteConfig{Path: filepath.Join(t.TempDir(), "missing.jsonl")}}); err == nil {
+		t.Fatalf("Expected an error replaying a missing cassette")
+	}
+	if _, err := newProvider(&Config{Cassette: CassetteConfig{Path: "cassette.jsonl", Mode: "rewind"}}); err == nil {
+		t.Fatalf("Expected an error for an unknown mode")
+	}
+	p, err := newProvider(&Config{Cassette: CassetteConfig{Path: "cassette.jsonl", Mode: cassetteRecord}})
+	if err != nil || p.name() != openAIProvider {
+		t.Fatalf("Expected to record from OpenAI, got %v, %v", p, err)
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/hooks"
+	"github.com/worldsayshi/cir/internal/mcp"
+	"github.com/worldsayshi/cir/internal/redact"
+	"github.com/worldsayshi/cir/internal/state"
+	"github.com/worldsayshi/cir/internal/tools"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Max number of tool call round trips before we give up on getting a final answer
+const maxToolRounds = 10
+
+// chat is the part of a conversation that doesn't depend on the TUI, so that it
+// can be shared with headless mode. The session is changed by dispatching actions
+// to the state store, the TUI renders it by subscribing to the store.
+type chat struct {
+	workingSession *types.WorkingSession
+	state          *state.Store
+	sessionFile    string
+	store          SessionStore
+	provider       provider
+	toolRegistry   *tools.Registry
+	mcpClients     map[string]*mcp.Client
+	hooks          hooks.Config
+	redactor       *redact.Redactor
+	spend          *spendTracker
+	lock           *sessionLock
+	// The version of the session as we last read or wrote it
+	version string
+	// Runs a change to the session on the goroutine that owns it, and returns when
+	// it's done. Answers are streamed on another goroutine and change the session
+	// through this. Headless, changes are made right away.
+	update func(change func())
+	// Saves come from both the UI and the streaming goroutine
+	saveMutex sync.Mutex
+}
+
+var errSessionModified = errors.New("the session was changed outside this cir")
+
+// newChat locks and loads a session. The MCP clients and spend tracker are shared
+// between chats. Call close when done with the chat.
+func newChat(store SessionStore, sessionFile string, config *Config, mcpClients map[string]*mcp.Client, spend *spendTracker) (*chat, error) {
+	lock, err := lockSession(sessionFile)
+	if err != nil {
+		return nil, err
+	}
+	workingSession, err := store.Load(sessionFile)
+	if err != nil {
+		lock.release()
+		return nil, fmt.Errorf("loading session %s: %w", sessionFile, err)
+	}
+	version, _ := store.Version(sessionFile)
+
+	provider, err := newProvider(config)
+	if err != nil {
+		lock.release()
+		return nil, err
+	}
+
+	// Tools are sandboxed to the directory cir is started in
+	toolRegistry, err := tools.NewRegistry(".")
+	if err != nil {
+		lock.release()
+		return nil, fmt.Errorf("setting up tools: %w", err)
+	}
+
+	redactor, err := redact.New(config.Redaction)
+	if err != nil {
+		// Fall back to the built-in detectors rather than sending secrets
+		log.Println("Error in redaction config:", err)
+		redactor, _ = redact.New(redact.Config{})
+	}
+
+	c := &chat{
+		workingSession: workingSession,
+		state:          state.NewStore(workingSession),
+		sessionFile:    sessionFile,
+		store:          store,
+		provider:       provider,
+		toolRegistry:   toolRegistry,
+		mcpClients:     mcpClients,
+		hooks:          config.Hooks,
+		redactor:       redactor,
+		spend:          spend,
+		lock:           lock,
+		version:        version,
+		update:         func(change func()) { change() },
+	}
+	registerMCPTools(toolRegistry, mcpClients)
+	return c, nil
+}
+
+func (c *chat) model() string {
+	return sessionModel(c.workingSession)
+}
+
+// save writes the session, unless someone else changed it since we last read or
+// wrote it. Then errSessionModified is returned and overwrite or reload decide.
+func (c *chat) save() error {
+	c.saveMutex.Lock()
+	defer c.saveMutex.Unlock()
+	if err := c.checkVersion(); err != nil {
+		return err
+	}
+	return c.write(c.store.Save)
+}
+
+// saveAppended is save for when messages were only added to the current branch, so
+// the store may write just those
+func (c *chat) saveAppended() error {
+	c.saveMutex.Lock()
+	defer c.saveMutex.Unlock()
+	if err := c.checkVersion(); err != nil {
+		return err
+	}
+	return c.write(c.store.AppendMessages)
+}
+
+func (c *chat) checkVersion() error {
+	current, err := c.store.Version(c.sessionFile)
+	// A deleted session is simply written again
+	if err == nil && current != "" && current != c.version {
+		return fmt.Errorf("%w: %s", errSessionModified, c.sessionFile)
+	}
+	return nil
+}
+
+// overwrite saves the session even if the file was changed by someone else
+func (c *chat) overwrite() error {
+	c.saveMutex.Lock()
+	defer c.saveMutex.Unlock()
+	return c.write(c.store.Save)
+}
+
+func (c *chat) write(save func(sessionFile string, workingSession *types.WorkingSession) error) error {
+	if err := save(c.sessionFile, c.workingSession); err != nil {
+		return err
+	}
+	version, err := c.store.Version(c.sessionFile)
+	c.version = version
+	return err
+}
+
+// reload replaces the session with what is in the store
+func (c *chat) reload() error {
+	workingSession, err := c.store.Load(c.sessionFile)
+	if err != nil {
+		return err
+	}
+	c.saveMutex.Lock()
+	c.workingSession = workingSession
+	c.version, _ = c.store.Version(c.sessionFile)
+	c.saveMutex.Unlock()
+	c.state.Dispatch(state.Loaded{Session: workingSession})
+	return nil
+}
+
+// switchTo locks and loads another session in place of this one. Renamed sessions
+// are switched to without reloading.
+func (c *chat) switchTo(sessionFile string, reload bool) error {
+	lock, err := lockSession(sessionFile)
+	if err != nil {
+		return err
+	}
+	workingSession := c.workingSession
+	if reload {
+		if workingSession, err = c.store.Load(sessionFile); err != nil {
+			lock.release()
+			return err
+		}
+	}
+	c.lock.release()
+	c.lock = lock
+	c.saveMutex.Lock()
+	c.workingSession = workingSession
+	c.sessionFile = sessionFile
+	c.version, _ = c.store.Version(sessionFile)
+	c.saveMutex.Unlock()
+	c.state.Dispatch(state.Loaded{Session: workingSession})
+	return nil
+}
+
+// close releases the session lock
+func (c *chat) close() {
+	c.lock.release()
+	c.lock = nil
+}
+
+// submitQuestion appends the user message for a question, with the context files that
+// changed since they were last sent and any extra files for this question only.
+// Secrets are redacted first, then pre-submit hooks may rewrite or veto. Reading the
+// files and running the hooks may take a while, so this is run off the UI goroutine
+// and the session is touched through update.
+func (c *chat) submitQuestion(question string, extraFiles []types.WorkingFile) ([]redact.Finding, error) {
+	var workingFiles []types.WorkingFile
+	var sessionFile string
+	c.update(func() {
+		workingFiles = append(workingFiles, c.workingSession.WorkingFiles...)
+		sessionFile = c.sessionFile
+	})
+	filesToSubmit := getFilesToSubmitWith(workingFiles, c.readWorkingFile)
+	filesToSubmit = append(filesToSubmit, extraFiles...)
+	question, filesToSubmit, findings := redactSecrets(c.redactor, question, filesToSubmit)
+	question, filesToSubmit, err := c.runPreSubmitHooks(sessionFile, question, filesToSubmit)
+	if err != nil {
+		return findings, err
+	}
+
+	content := prepareUserMessage(filesToSubmit, question)
+	now := time.Now()
+	c.update(func() {
+		c.state.Dispatch(state.Submit{Message: types.Message{
+			AiServiceMessage:     types.AiServiceMessage{Role: types.RoleUser, Content: content},
+			Question:             question,
+			IncludedWorkingFiles: filesToSubmit,
+			Time:                 &now,
+		}})
+		if err := c.saveAppended(); err != nil {
+			log.Println("Error saving session:", err)
+		}
+	})
+	return findings, nil
+}
+
+// regenerate removes the last answer from the current branch so it can be streamed
+// again. With keep the old answer stays in the tree as an alternative to flip back to.
+func (c *chat) regenerate(keep bool) error {
+	messages := c.workingSession.Messages
+	idx := len(messages)
+	for idx > 0 && messages[idx-1].Role != types.RoleUser {
+		idx--
+	}
+	if idx == 0 || idx == len(messages) {
+		return fmt.Errorf("there is no answer to regenerate")
+	}
+	if keep {
+		c.state.Dispatch(state.Forked{Index: idx})
+	} else {
+		c.state.Dispatch(state.Removed{Index: idx})
+	}
+	return c.save()
+}
+
+// newAnswer is the message a streamed answer goes into, with when and by what
+// it was produced
+func newAnswer(provider string, model string) types.Message {
+	now := time.Now()
+	return types.Message{
+		AiServiceMessage:     types.AiServiceMessage{Role: types.RoleSystem, Content: ""},
+		IncludedWorkingFiles: []types.WorkingFile{},
+		Time:                 &now,
+		Provider:             provider,
+		Model:                model,
+	}
+}
+
+// The usage of a completion, if the provider reported it
+func receivedUsage(usageChan chan types.Usage) *types.Usage {
+	select {
+	case usage := <-usageChan:
+		return &usage
+	default:
+		return nil
+	}
+}
+
+// Dispatch an action that finishes the answer being streamed, and record what the
+// answer cost
+func (c *chat) finishAnswer(action state.Action) {
+	idx := c.state.State().Answer
+	c.state.Dispatch(action)
+	if idx >= 0 {
+		c.spend.record(c.sessionFile, c.workingSession.Messages[idx])
+	}
+}
+
+// Add an empty message for the streaming response and start streaming
+func (c *chat) streamCompletion(ctx context.Context, options completionOptions) (chan string, chan []types.ToolCall, chan types.Usage, chan error) {
+	serviceMessages := []types.AiServiceMessage{}
+	c.update(func() {
+		for _, msg := range c.workingSession.Messages {
+			serviceMessages = append(serviceMessages, msg.AiServiceMessage)
+		}
+		c.state.Dispatch(state.StreamStarted{Answer: newAnswer(c.provider.name(), options.Model)})
+	})
+	return c.provider.stream(ctx, options, serviceMessages, c.toolRegistry.Definitions())
+}
+
+// Run the tool calls and add the results, with secrets redacted like in questions. Each
+// result is saved as it comes, tools may take a while.
+func (c *chat) runToolCalls(toolCalls []types.ToolCall) {
+	for _, call := range toolCalls {
+		result, findings := redactToolResult(c.redactor, call, c.toolRegistry.Call(call))
+		for _, finding := range findings {
+			log.Println("Redacted from tool result:", finding)
+		}
+		c.update(func() {
+			c.state.Dispatch(state.ToolResult{Message: types.Message{
+				AiServiceMessage: types.AiServiceMessage{
+					Role:       types.RoleTool,
+					Content:    result,
+					ToolCallID: call.ID,
+				},
+			}})
+			if err := c.saveAppended(); err != nil {
+				log.Println("Error saving tool result:", err)
+			}
+		})
+	}
+}
+
+// streamAnswer streams the answer to the conversation so far with the given model and
+// temperature. Tool calls are run and their results sent back until the model gives a
+// final answer. onChunk is called for each streamed chunk and onToolCalls after each
+// round of tool calls, both through update like every change to the session. The
+// session is saved when done, and a failure is also recorded in the answer message.
+// Cancelling ctx stops the answer, what was streamed so far is kept and ctx's error
+// returned.
+func (c *chat) streamAnswer(ctx context.Context, options completionOptions, onChunk func(chunk string), onToolCalls func()) error {
+	resultChan, toolCallChan, usageChan, errChan := c.streamCompletion(ctx, options)
+	toolRounds := 0
+	// End the stream and save, the error replaces the answer unless it was stopped.
+	// Post-response hooks get a finished answer before the stream ends.
+	finish := func(err error) error {
+		now := time.Now()
+		idx := -1
+		var payload hooks.Payload
+		if err == nil {
+			c.update(func() {
+				if idx = c.state.State().Answer; idx >= 0 {
+					messages := c.workingSession.Messages
+					payload = c.postResponsePayload(messages[:idx], messages[idx].Content)
+				}
+			})
+		}
+		var rewrite string
+		rewritten := false
+		if idx >= 0 {
+			rewrite, rewritten = c.runPostResponseHooks(payload)
+		}
+		c.update(func() {
+			if rewritten {
+				c.state.Dispatch(state.AnswerRewritten{Index: idx, Content: rewrite})
+			}
+			done := state.StreamDone{Usage: receivedUsage(usageChan), Time: now}
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Error: %v", err)
+				done.Err = err
+			}
+			c.finishAnswer(done)
+			if saveErr := c.saveAppended(); saveErr != nil {
+				log.Println("Error saving session:", saveErr)
+				if err == nil {
+					err = saveErr
+				}
+			}
+		})
+		return err
+	}
+	for {
+		select {
+		case toolCalls, ok := <-toolCallChan:
+			if !ok {
+				toolCallChan = nil
+				continue
+			}
+			toolRounds++
+			if toolRounds > maxToolRounds {
+				return finish(fmt.Errorf("no final answer after %d rounds of tool calls", maxToolRounds))
+			}
+			c.update(func() {
+				c.finishAnswer(state.ToolCallsReceived{ToolCalls: toolCalls, Usage: receivedUsage(usageChan), Time: time.Now()})
+			})
+			c.runToolCalls(toolCalls)
+			c.update(onToolCalls)
+
+			// Let the model continue with the tool results
+			resultChan, toolCallChan, usageChan, errChan = c.streamCompletion(ctx, options)
+		case chunk, ok := <-resultChan:
+			if !ok {
+				// Stream completed
+				return finish(nil)
+			}
+			c.update(func() {
+				c.state.Dispatch(state.ChunkReceived{Chunk: chunk, Time: time.Now()})
+				onChunk(chunk)
+			})
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			if ctx.Err() != nil {
+				return finish(ctx.Err())
+			}
+			return finish(err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/state"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// The flow from question to rendered answer, without a terminal
+func TestStreamAnswerRenders(t *testing.T) {
+	c, err := newChat(&yamlStore{}, filepath.Join(t.TempDir(), "session.yaml"), &Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	c.provider = newScripted(chunks("Hello", " there"))
+	rendered := []string{}
+	c.state.Subscribe(state.Messages, func(s state.State) {
+		messages := s.Session.Messages
+		rendered = append(rendered, messages[len(messages)-1].Content)
+	})
+	streaming := []bool{}
+	c.state.Subscribe(state.Stream, func(s state.State) { streaming = append(streaming, s.Streaming) })
+
+	if _, err := c.submitQuestion("Hi", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.streamAnswer(context.Background(), completionOptions{Model: "gpt-4o"}, func(string) {}, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{prepareUserMessage([]types.WorkingFile{}, "Hi"), "", "Hello", "Hello there", "Hello there"}
+	if len(rendered) != len(expected) {
+		t.Fatalf("Expected renders %q, got %q", expected, rendered)
+	}
+	for i := range expected {
+		if rendered[i] != expected[i] {
+			t.Fatalf("Expected renders %q, got %q", expected, rendered)
+		}
+	}
+	if len(streaming) != 2 || !streaming[0] || streaming[1] {
+		t.Fatalf("Expected streaming to start and stop, got %v", streaming)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/worldsayshi/cir/internal/export"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Subcommands for managing sessions from the shell. Sessions are named by their
+// file name in the cir dir, or given as a path.
+
+func runSessions(store SessionStore, cirDir string, args []string, out io.Writer) error {
+	usage := fmt.Errorf("usage: cir sessions list|show <name>|rm <name>|rename <old> <new>|copy <src> <dst>")
+	if len(args) == 0 {
+		return usage
+	}
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		sessions, err := store.List()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tMESSAGES\tMODIFIED\tTITLE")
+		for _, s := range sessions {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", s.Name, s.MessageCount, s.ModTime.Format("2006-01-02 15:04"), s.Title)
+		}
+		return tw.Flush()
+	case args[0] == "show" && len(args) == 2:
+		sessionFile := resolveSessionFile(cirDir, args[1])
+		workingSession, err := loadExistingSession(store, sessionFile)
+		if err != nil {
+			return err
+		}
+		return export.Markdown(out, sessionName(sessionFile), workingSession)
+	case args[0] == "rm" && len(args) == 2:
+		sessionFile := resolveSessionFile(cirDir, args[1])
+		return withSessionLock(sessionFile, func() error {
+			return removeSession(store, sessionFile)
+		})
+	case (args[0] == "rename" || args[0] == "copy") && len(args) == 3:
+		src := resolveSessionFile(cirDir, args[1])
+		dst := resolveSessionFile(cirDir, args[2])
+		// The destination may be open in a cir that would save over it
+		return withSessionLocks([]string{src, dst}, func() error {
+			if args[0] == "copy" {
+				return copySession(store, src, dst)
+			}
+			return renameSession(store, src, dst)
+		})
+	}
+	return usage
+}
+
+func runContext(store SessionStore, cirDir string, defaultSessionFile string, args []string, out io.Writer) error {
+	usage := fmt.Errorf("usage: cir context [-session name] add <files...>|rm <files...>|ls")
+	flags := flag.NewFlagSet("context", flag.ContinueOnError)
+	flags.SetOutput(out)
+	session := flags.String("session", defaultSessionFile, "session name or path")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		return usage
+	}
+
+	sessionFile := resolveSessionFile(cirDir, *session)
+	return withSessionLock(sessionFile, func() error {
+		return editContext(store, sessionFile, args, out, usage)
+	})
+}
+
+func editContext(store SessionStore, sessionFile string, args []string, out io.Writer, usage error) error {
+	workingSession, err := store.Load(sessionFile)
+	if err != nil {
+		return err
+	}
+	switch {
+	case args[0] == "ls" && len(args) == 1:
+		for _, wf := range workingSession.WorkingFiles {
+			if wf.McpServer != "" {
+				fmt.Fprintf(out, "%s:%s\n", wf.McpServer, wf.Path)
+			} else {
+				fmt.Fprintln(out, wf.Path)
+			}
+		}
+		return nil
+	case args[0] == "add" && len(args) > 1:
+		if err := addWorkingFiles(workingSession, args[1:]); err != nil {
+			return err
+		}
+		return store.Save(sessionFile, workingSession)
+	case args[0] == "rm" && len(args) > 1:
+		remove := map[string]bool{}
+		for _, p := range args[1:] {
+			remove[p] = true
+		}
+		kept := []types.WorkingFile{}
+		for _, wf := range workingSession.WorkingFiles {
+			if !remove[wf.Path] {
+				kept = append(kept, wf)
+			}
+		}
+		workingSession.WorkingFiles = kept
+		return store.Save(sessionFile, workingSession)
+	}
+	return usage
+}
+
+func runExport(store SessionStore, cirDir string, defaultSessionFile string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(out)
+	session := flags.String("session", defaultSessionFile, "session name or path")
+	output := flags.String("o", "", "write to this file instead of stdout")
+	format := flags.String("format", "", "md, html or json. Defaults to the extension of -o, or md")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	exportFunc := export.Markdown
+	var err error
+	if *format != "" {
+		exportFunc, err = export.Format(*format)
+	} else if *output != "" {
+		exportFunc, err = export.FormatForPath(*output)
+	}
+	if err != nil {
+		return err
+	}
+
+	sessionFile := resolveSessionFile(cirDir, *session)
+	workingSession, err := loadExistingSession(store, sessionFile)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return exportFunc(out, sessionName(sessionFile), workingSession)
+}
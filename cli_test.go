@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func setupCirDir(t *testing.T, storage string) (string, SessionStore) {
+	cirDir := t.TempDir()
+	store, err := openSessionStore(cirDir, &Config{Storage: storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	session := &types.WorkingSession{
+		Messages: []types.Message{
+			{AiServiceMessage: types.AiServiceMessage{Role: "user", Content: "Hello"}, Question: "Hello"},
+			{AiServiceMessage: types.AiServiceMessage{Role: "system", Content: "Hi there!"}},
+		},
+	}
+	if err := store.Save(filepath.Join(cirDir, "review.yaml"), session); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cirDir, configFileName), []byte("plugins: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return cirDir, store
+}
+
+func TestSessionsListCopyRenameRm(t *testing.T) {
+	for _, storage := range []string{storageYAML, storageSQLite} {
+		cirDir, store := setupCirDir(t, storage)
+		var out bytes.Buffer
+
+		if err := runSessions(store, cirDir, []string{"copy", "review", "design"}, &out); err != nil {
+			t.Fatal(err)
+		}
+		if err := runSessions(store, cirDir, []string{"copy", "review", "design"}, &out); err == nil {
+			t.Fatalf("Expected copying onto an existing session to fail")
+		}
+		// A session open in another cir can't be overwritten
+		lock, err := lockSession(filepath.Join(cirDir, "draft.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, command := range []string{"copy", "rename"} {
+			if err := runSessions(store, cirDir, []string{command, "design", "draft"}, &out); err == nil {
+				t.Fatalf("Expected %s onto a locked session to fail", command)
+			}
+		}
+		lock.release()
+		if err := runSessions(store, cirDir, []string{"rename", "design", "design-v2"}, &out); err != nil {
+			t.Fatal(err)
+		}
+		if err := runSessions(store, cirDir, []string{"rm", "review"}, &out); err != nil {
+			t.Fatal(err)
+		}
+
+		out.Reset()
+		if err := runSessions(store, cirDir, []string{"list"}, &out); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[1], "design-v2") || !strings.Contains(lines[1], "Hello") {
+			t.Fatalf("Unexpected session list:\n%s", out.String())
+		}
+	}
+}
+
+func TestContextAddRmLs(t *testing.T) {
+	cirDir, store := setupCirDir(t, storageYAML)
+	file := filepath.Join(cirDir, "notes.txt")
+	if err := os.WriteFile(file, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+
+	if err := runContext(store, cirDir, "default", []string{"-session", "review", "add", file}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := runContext(store, cirDir, "default", []string{"-session", "review", "ls"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != file+"\n" {
+		t.Fatalf("Expected %s in the context, got %q", file, out.String())
+	}
+
+	out.Reset()
+	if err := runContext(store, cirDir, "default", []string{"-session", "review", "rm", file}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := runContext(store, cirDir, "default", []string{"-session", "review", "ls"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "" {
+		t.Fatalf("Expected an empty context, got %q", out.String())
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	cirDir, store := setupCirDir(t, storageYAML)
+	var out bytes.Buffer
+
+	if err := runExport(store, cirDir, "", []string{"-session", "review", "-format", "json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var exported struct {
+		Title    string `json:"title"`
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.Title != "review" || len(exported.Messages) != 2 || exported.Messages[1].Content != "Hi there!" {
+		t.Fatalf("Unexpected JSON export:\n%s", out.String())
+	}
+
+	// The format follows the output file's extension
+	htmlFile := filepath.Join(t.TempDir(), "review.html")
+	if err := runExport(store, cirDir, "", []string{"-session", "review", "-o", htmlFile}, &out); err != nil {
+		t.Fatal(err)
+	}
+	html, err := os.ReadFile(htmlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(html), "<!DOCTYPE html>") || !strings.Contains(string(html), "Hi there!") {
+		t.Fatalf("Unexpected HTML export:\n%s", html)
+	}
+
+	if err := runExport(store, cirDir, "", []string{"-session", "review", "-format", "pdf"}, &out); err == nil {
+		t.Fatalf("Expected an unknown format to fail")
+	}
+}
+
+func TestImport(t *testing.T) {
+	cirDir, store := setupCirDir(t, storageYAML)
+	export := filepath.Join(t.TempDir(), "conversations.json")
+	data := `[{"title": "Review", "messages": [{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello!"}]}]`
+	if err := os.WriteFile(export, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := runImport(store, cirDir, []string{export}, &out); err != nil {
+		t.Fatal(err)
+	}
+	// review is taken
+	if out.String() != "Imported review-2 (2 messages)\n" {
+		t.Fatalf("Unexpected output: %q", out.String())
+	}
+	workingSession, err := loadExistingSession(store, resolveSessionFile(cirDir, "review-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workingSession.Messages) != 2 || workingSession.Messages[1].Content != "Hello!" {
+		t.Fatalf("Unexpected imported session: %v", workingSession.Messages)
+	}
+}
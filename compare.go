@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/components"
+	"github.com/worldsayshi/cir/internal/hooks"
+	"github.com/worldsayshi/cir/internal/state"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// The answer of one model in a comparison
+type comparisonAnswer struct {
+	content string
+	done    bool
+	// The stream failed, content is the error and can't be chosen
+	err error
+	// The answer as streamed, with who answered how fast
+	metadata types.Message
+}
+
+// compare streams answers to the last question from several models at once. Tools are
+// not offered, the answers have to stand on their own. onChunk is called with the answer
+// so far and onDone with the metadata of the answer when a model is done, or the error
+// it failed with, both through update. Returns when all models are done, or stopped by
+// cancelling ctx.
+func (c *chat) compare(ctx context.Context, models []string, onChunk func(i int, content string), onDone func(i int, metadata types.Message, err error)) {
+	serviceMessages := []types.AiServiceMessage{}
+	c.update(func() {
+		for _, msg := range c.workingSession.Messages {
+			serviceMessages = append(serviceMessages, msg.AiServiceMessage)
+		}
+	})
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The answer streams into a session of its own, through the same actions as
+			// an answer in the chat. Only this goroutine touches it.
+			answer := state.NewStore(&types.WorkingSession{})
+			answer.Dispatch(state.StreamStarted{Answer: newAnswer(c.provider.name(), model)})
+			var failed error
+			resultChan, toolCallChan, usageChan, errChan := c.provider.stream(ctx, completionOptions{Model: model}, serviceMessages, nil)
+			for resultChan != nil || toolCallChan != nil || errChan != nil {
+				select {
+				case chunk, ok := <-resultChan:
+					if !ok {
+						resultChan = nil
+						continue
+					}
+					answer.Dispatch(state.ChunkReceived{Chunk: chunk, Time: time.Now()})
+					content := answer.State().Session.Messages[0].Content
+					c.update(func() { onChunk(i, content) })
+				case _, ok := <-toolCallChan:
+					if !ok {
+						toolCallChan = nil
+					}
+				case err, ok := <-errChan:
+					if !ok {
+						errChan = nil
+						continue
+					}
+					if ctx.Err() != nil {
+						continue
+					}
+					log.Printf("Error comparing %s: %v", model, err)
+					failed = err
+				}
+			}
+			// A failure replaces the answer
+			answer.Dispatch(state.StreamDone{Usage: receivedUsage(usageChan), Err: failed, Time: time.Now()})
+			metadata := answer.State().Session.Messages[0]
+			c.update(func() {
+				if failed != nil {
+					onChunk(i, metadata.Content)
+				}
+				// Every answer costs, chosen or not
+				c.spend.record(c.sessionFile, metadata)
+				onDone(i, metadata, failed)
+			})
+		}()
+	}
+	wg.Wait()
+}
+
+// commitComparison adds the chosen answer to the current branch, after post-response
+// hooks had their say about it. The other finished answers are kept as alternatives
+// to it, failed ones are dropped. The answers must no longer change, the session is
+// changed through update.
+func (c *chat) commitComparison(answers []comparisonAnswer, chosen int) error {
+	if !answers[chosen].done || answers[chosen].err != nil {
+		return fmt.Errorf("answer %d can't be chosen, it isn't done or it failed", chosen+1)
+	}
+	var payload hooks.Payload
+	c.update(func() {
+		payload = c.postResponsePayload(c.workingSession.Messages, answers[chosen].content)
+	})
+	content, rewritten := c.runPostResponseHooks(payload)
+	if !rewritten {
+		content = answers[chosen].content
+	}
+
+	answerMessage := func(answer comparisonAnswer, content string) types.Message {
+		msg := answer.metadata
+		msg.AiServiceMessage = types.AiServiceMessage{Role: types.RoleSystem, Content: content}
+		return msg
+	}
+	committed := state.ComparisonCommitted{Chosen: answerMessage(answers[chosen], content)}
+	for i, answer := range answers {
+		if i != chosen && answer.done && answer.err == nil {
+			committed.Alternatives = append(committed.Alternatives, answerMessage(answer, answer.content))
+		}
+	}
+	var err error
+	c.update(func() {
+		c.state.Dispatch(committed)
+		err = c.save()
+	})
+	return err
+}
+
+// dropLastQuestion removes a question that was never answered, for a cancelled
+// comparison. The session is changed through update.
+func (c *chat) dropLastQuestion() error {
+	var err error
+	c.update(func() {
+		c.state.Dispatch(state.Removed{Index: len(c.workingSession.Messages) - 1})
+		err = c.save()
+	})
+	return err
+}
+
+// Submit the input like Ctrl+S, but stream the answer from all the models in
+// compare_models side by side and let the user choose one
+func (t *tab) submitComparison() {
+	app := t.app
+	models := app.config.CompareModels
+	text := t.inputArea.GetText()
+	if t.streaming() || text == "" {
+		return
+	}
+	if len(models) < 2 {
+		app.showTextModal("Compare models", "Configure at least two models in compare_models to compare them")
+		return
+	}
+	t.checkSpending(func() {
+		t.submitInBackground(text, func() { t.startComparison(text, models) })
+	})
+}
+
+// Stream the answers to the question just submitted and show them side by side
+func (t *tab) startComparison(text string, models []string) {
+	app := t.app
+
+	// Only touched on the UI goroutine
+	answers := make([]comparisonAnswer, len(models))
+	finished := false
+	ctx, cancel := context.WithCancel(context.Background())
+	// Committing runs hooks and goes through update, so it is left to a goroutine
+	finish := func(commit func() error) {
+		finished = true
+		cancel()
+		app.pages.RemovePage("compare")
+		go func() {
+			err := commit()
+			t.update(func() {
+				if err != nil {
+					log.Println("Error saving session:", err)
+				}
+				t.state.Dispatch(state.StreamDone{Time: time.Now()})
+				app.SetFocus(t.inputArea)
+			})
+		}()
+	}
+	view := components.NewComparisonView(app.Application, models,
+		func(i int) {
+			// Answers still streaming are stopped and dropped
+			finish(func() error { return t.commitComparison(answers, i) })
+		},
+		func() {
+			finish(t.dropLastQuestion)
+			t.inputArea.SetText(text, true)
+		},
+	)
+	app.pages.AddPage("compare", view, true, true)
+	app.SetFocus(view)
+
+	go t.compare(ctx, models,
+		func(i int, content string) {
+			if !finished {
+				answers[i].content = content
+				view.SetContent(i, content)
+			}
+		},
+		func(i int, metadata types.Message, err error) {
+			if !finished {
+				answers[i].done = true
+				answers[i].metadata = metadata
+				answers[i].err = err
+				if err != nil {
+					view.SetFailed(i)
+				} else {
+					view.SetDone(i)
+				}
+			}
+		},
+	)
+}
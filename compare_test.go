@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func TestCommitComparison(t *testing.T) {
+	sessionFile := filepath.Join(t.TempDir(), "session.yaml")
+	c, err := newChat(&yamlStore{}, sessionFile, &Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.workingSession.Messages = []types.Message{
+		{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser, Content: "Hello"}, Question: "Hello"},
+	}
+
+	answers := []comparisonAnswer{
+		{content: "Hi from a", done: true},
+		{content: "Hi from b", done: true},
+		{content: "Hi fr", done: false},
+	}
+	if err := c.commitComparison(answers, 1); err != nil {
+		t.Fatal(err)
+	}
+	messages := c.workingSession.Messages
+	if len(messages) != 2 || messages[1].Content != "Hi from b" {
+		t.Fatalf("Expected the chosen answer to be committed, got %v", messages)
+	}
+	// The other finished answer is kept as an alternative
+	if siblings, pos := c.workingSession.Siblings(1); len(siblings) != 2 || pos != 1 {
+		t.Fatalf("Expected two alternatives with the chosen one current, got %v at %d", siblings, pos)
+	}
+
+	loaded, err := loadWorkingSession(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Messages) != 2 || loaded.Messages[1].Content != "Hi from b" {
+		t.Fatalf("Expected the chosen answer to be saved as the current branch")
+	}
+}
+
+func TestCommitFailedComparison(t *testing.T) {
+	sessionFile := filepath.Join(t.TempDir(), "session.yaml")
+	c, err := newChat(&yamlStore{}, sessionFile, &Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.workingSession.Messages = []types.Message{
+		{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser, Content: "Hello"}, Question: "Hello"},
+	}
+
+	failed := errors.New("model not found")
+	answers := []comparisonAnswer{
+		{content: "Error: model not found", done: true, err: failed},
+		{content: "Hi from b", done: true},
+	}
+	if err := c.commitComparison(answers, 0); err == nil {
+		t.Fatalf("Expected a failed answer not to be committed")
+	}
+	if err := c.commitComparison(answers, 1); err != nil {
+		t.Fatal(err)
+	}
+	// The failed answer isn't kept as an alternative
+	if siblings, _ := c.workingSession.Siblings(1); len(siblings) != 1 {
+		t.Fatalf("Expected only the chosen answer, got %v", siblings)
+	}
+}
+
+func TestDropLastQuestion(t *testing.T) {
+	sessionFile := filepath.Join(t.TempDir(), "session.yaml")
+	c, err := newChat(&yamlStore{}, sessionFile, &Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.workingSession.Messages = []types.Message{
+		{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser, Content: "Hello"}, Question: "Hello"},
+	}
+	if err := c.dropLastQuestion(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.workingSession.Messages) != 0 || len(c.workingSession.Tree) != 0 {
+		t.Fatalf("Expected the question to be removed")
+	}
+}
+
+func TestComparisonAnswerMetadata(t *testing.T) {
+	sessionFile := filepath.Join(t.TempDir(), "session.yaml")
+	c, err := newChat(&yamlStore{}, sessionFile, &Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.workingSession.Messages = []types.Message{
+		{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser, Content: "Hello"}, Question: "Hello"},
+	}
+	c.provider = newScripted(chunks("Hi"), chunks("Hi"))
+	answers := make([]comparisonAnswer, 2)
+	// Headless, the models report on their own goroutines
+	var mutex sync.Mutex
+	c.compare(context.Background(), []string{"gpt-4o", "gpt-4o"},
+		func(i int, content string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			answers[i].content = content
+		},
+		func(i int, metadata types.Message, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			answers[i].done = true
+			answers[i].metadata = metadata
+			answers[i].err = err
+		},
+	)
+
+	if err := c.commitComparison(answers, 0); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadWorkingSession(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := loaded.Messages[1]
+	if answer.Model != "gpt-4o" || answer.Provider != scriptedProvider || answer.Time == nil || answer.Duration == 0 {
+		t.Fatalf("Expected the metadata to be saved with the answer, got %+v", answer)
+	}
+	if answer.Usage == nil || answer.Usage.TotalTokens != 11 {
+		t.Fatalf("Expected the token usage to be saved, got %v", answer.Usage)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/worldsayshi/cir/internal/cost"
+	"github.com/worldsayshi/cir/internal/hooks"
+	"github.com/worldsayshi/cir/internal/plugins"
+	"github.com/worldsayshi/cir/internal/redact"
+	"gopkg.in/yaml.v2"
+)
+
+type MCPServerConfig struct {
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+}
+
+// Answers are recorded to or replayed from a cassette file, to test without the API
+type CassetteConfig struct {
+	Path string `yaml:"path"`
+	// record, or replay which is the default
+	Mode string `yaml:"mode,omitempty"`
+}
+
+type Config struct {
+	MCPServers map[string]MCPServerConfig `yaml:"mcp_servers,omitempty"`
+	Plugins    map[string]plugins.Plugin  `yaml:"plugins,omitempty"`
+	Hooks      hooks.Config               `yaml:"hooks,omitempty"`
+	Redaction  redact.Config              `yaml:"redaction,omitempty"`
+	// Models that Ctrl+P streams answers from side by side
+	CompareModels []string `yaml:"compare_models,omitempty"`
+	// Keep a search index in the cir dir so searching doesn't read every session
+	SearchIndex bool `yaml:"search_index,omitempty"`
+	// Prices and spending limits
+	Spending cost.Config `yaml:"spending,omitempty"`
+	// Where sessions are kept: yaml files in the cir dir (the default) or sqlite
+	Storage  string         `yaml:"storage,omitempty"`
+	Cassette CassetteConfig `yaml:"cassette,omitempty"`
+}
+
+// loadConfig reads the config file. A missing file gives an empty config.
+func loadConfig(configFile string) (*Config, error) {
+	data, err := os.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		log.Println("Config file not found, using defaults:", configFile)
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/worldsayshi/cir/internal/components"
+)
+
+func (cirApp *CirApplication) showTextModal(title string, text string) {
+	previousFocus := cirApp.GetFocus()
+	textView := tview.NewTextView().SetText(text)
+	textView.
+		SetBorder(true).
+		SetTitle(title + " (Esc to close)")
+	textView.SetDoneFunc(func(key tcell.Key) {
+		cirApp.pages.RemovePage("text")
+		cirApp.SetFocus(previousFocus)
+	})
+	cirApp.pages.AddPage("text", components.Centered(textView, 100, 25), true, true)
+	cirApp.SetFocus(textView)
+}
+
+// confirm asks a yes/no question and calls yes if the user agrees
+func (cirApp *CirApplication) confirm(question string, yes func()) {
+	cirApp.choose(question, []string{"Yes", "No"}, func(button string) {
+		if button == "Yes" {
+			yes()
+		}
+	})
+}
+
+// choose asks the user to pick one of the buttons. Escape picks none.
+func (cirApp *CirApplication) choose(question string, buttons []string, done func(button string)) {
+	previousFocus := cirApp.GetFocus()
+	modal := tview.NewModal().
+		SetText(question).
+		AddButtons(buttons).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			cirApp.pages.RemovePage("choose")
+			cirApp.SetFocus(previousFocus)
+			if buttonIndex >= 0 {
+				done(buttonLabel)
+			}
+		})
+	cirApp.pages.AddPage("choose", modal, true, true)
+	cirApp.SetFocus(modal)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/worldsayshi/cir/internal/hooks"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Let pre-submit hooks veto or rewrite the question and the files about to be sent
+func (c *chat) runPreSubmitHooks(sessionFile string, question string, filesToSubmit []types.WorkingFile) (string, []types.WorkingFile, error) {
+	payload := hooks.Payload{
+		SessionFile: sessionFile,
+		Question:    question,
+	}
+	for _, wf := range filesToSubmit {
+		payload.Files = append(payload.Files, hooks.File{Path: wf.Path, Content: string(wf.FileContent)})
+	}
+
+	payload, err := c.hooks.Run(hooks.PreSubmit, payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rewrittenFiles := []types.WorkingFile{}
+	for _, f := range payload.Files {
+		wf := types.WorkingFile{Path: f.Path}
+		for _, original := range filesToSubmit {
+			if original.Path == f.Path {
+				wf = original
+			}
+		}
+		wf.FileContent = []byte(f.Content)
+		rewrittenFiles = append(rewrittenFiles, wf)
+	}
+	return payload.Question, rewrittenFiles, nil
+}
+
+// The post-response payload for a response to the given messages
+func (c *chat) postResponsePayload(messages []types.Message, response string) hooks.Payload {
+	payload := hooks.Payload{
+		SessionFile: c.sessionFile,
+		Response:    response,
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == types.RoleUser {
+			payload.Question = messages[i].Question
+			for _, wf := range messages[i].IncludedWorkingFiles {
+				payload.Files = append(payload.Files, hooks.File{Path: wf.Path})
+			}
+			break
+		}
+	}
+	return payload
+}
+
+// Let post-response hooks see, rewrite or veto a response. Hooks are commands that
+// may take a while, so this is run off the UI goroutine. Gives the content the answer
+// should have instead, if any.
+func (c *chat) runPostResponseHooks(payload hooks.Payload) (string, bool) {
+	response := payload.Response
+	payload, err := c.hooks.Run(hooks.PostResponse, payload)
+	if err != nil {
+		log.Println("Post-response hook:", err)
+		return fmt.Sprintf("Error: %v", err), true
+	}
+	return payload.Response, payload.Response != response
+}
+
+// Let on-edit-applied hooks see a command the model had run, which may have changed
+// files. They may rewrite the output the model gets. A veto can't undo the command,
+// its reason is added to the output instead, so a hook that checks the changes can
+// tell the model what is wrong with them.
+func (c *chat) runEditAppliedHooks(payload hooks.Payload) string {
+	output := payload.Output
+	payload, err := c.hooks.Run(hooks.OnEditApplied, payload)
+	var veto *hooks.VetoError
+	if errors.As(err, &veto) {
+		return fmt.Sprintf("%s\nA hook objected to the changes: %s", strings.TrimRight(output, "\n"), veto.Reason)
+	}
+	if err != nil {
+		log.Println("On-edit-applied hook:", err)
+		return output
+	}
+	return payload.Output
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/worldsayshi/cir/internal/importer"
+)
+
+const maxImportedNameLength = 40
+
+var nonNameCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// A session name from a conversation title that isn't taken in the cir dir
+func importedSessionName(store SessionStore, cirDir string, title string) (string, error) {
+	name := strings.Trim(nonNameCharacters.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(name) > maxImportedNameLength {
+		name = strings.TrimRight(name[:maxImportedNameLength], "-")
+	}
+	if name == "" {
+		name = "imported"
+	}
+	candidate := name
+	for i := 2; ; i++ {
+		version, err := store.Version(resolveSessionFile(cirDir, candidate))
+		if err != nil || version == "" {
+			return candidate, err
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+}
+
+// runImport implements `cir import`: one session per conversation in an export file
+func runImport(store SessionStore, cirDir string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(out)
+	format := flags.String("format", "", "chatgpt, llm or messages. Detected if not given")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: cir import [-format chatgpt|llm|messages] <export.json>")
+	}
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	conversations, err := importer.Import(data, *format)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cirDir, 0755); err != nil {
+		return err
+	}
+	for _, conversation := range conversations {
+		name, err := importedSessionName(store, cirDir, conversation.Title)
+		if err != nil {
+			return err
+		}
+		sessionFile := resolveSessionFile(cirDir, name)
+		if err := store.Save(sessionFile, conversation.Session); err != nil {
+			return err
+		}
+		// Keep the conversations in their original order in the session list. The
+		// SQLite store orders by when sessions were saved.
+		if _, ok := store.(*yamlStore); ok && !conversation.Updated.IsZero() {
+			if err := os.Chtimes(sessionFile, conversation.Updated, conversation.Updated); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(out, "Imported %s (%d messages)\n", name, len(conversation.Session.Tree))
+	}
+	return nil
+}
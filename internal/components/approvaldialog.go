@@ -0,0 +1,26 @@
+package components
+
+import (
+	"github.com/rivo/tview"
+)
+
+// NewCommandApprovalDialog shows a command proposed by the model. The user can edit it
+// before running it, or reject it. Escape rejects.
+func NewCommandApprovalDialog(command string, done func(command string, approved bool)) *tview.Form {
+	form := tview.NewForm()
+	form.AddInputField("Command", command, 0, nil, nil)
+	form.AddButton("Run", func() {
+		edited := form.GetFormItemByLabel("Command").(*tview.InputField).GetText()
+		done(edited, true)
+	})
+	form.AddButton("Reject", func() {
+		done(command, false)
+	})
+	form.SetCancelFunc(func() {
+		done(command, false)
+	})
+	form.
+		SetBorder(true).
+		SetTitle("The model wants to run a command")
+	return form
+}
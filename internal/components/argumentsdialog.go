@@ -0,0 +1,43 @@
+package components
+
+import "github.com/rivo/tview"
+
+// An Argument is a value asked for by NewArgumentsDialog
+type Argument struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// NewArgumentsDialog asks for a value for each argument, like those of an MCP prompt.
+// Required arguments are marked with a *. Escape cancels.
+func NewArgumentsDialog(title string, arguments []Argument, done func(values map[string]string, ok bool)) *tview.Form {
+	form := tview.NewForm()
+	fields := []*tview.InputField{}
+	for _, argument := range arguments {
+		label := argument.Name
+		if argument.Required {
+			label += " *"
+		}
+		field := tview.NewInputField().SetLabel(label).SetPlaceholder(argument.Description)
+		form.AddFormItem(field)
+		fields = append(fields, field)
+	}
+	form.AddButton("OK", func() {
+		values := map[string]string{}
+		for i, argument := range arguments {
+			values[argument.Name] = fields[i].GetText()
+		}
+		done(values, true)
+	})
+	form.AddButton("Cancel", func() {
+		done(nil, false)
+	})
+	form.SetCancelFunc(func() {
+		done(nil, false)
+	})
+	form.
+		SetBorder(true).
+		SetTitle(title)
+	return form
+}
@@ -1,30 +1,180 @@
 package components
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/worldsayshi/cir/internal/types"
 )
 
-func InitChatHistory(workingSession *types.WorkingSession) *tview.TextView {
+const messageRegionPrefix = "msg-"
+
+type ChatHistoryHandlers struct {
+	// Edit the user message at idx into a new branch
+	Edit func(idx int)
+	// Go to the previous (-1) or next (1) branch at the message at idx
+	SwitchBranch func(idx int, delta int)
+	// Show the metadata of the message at idx
+	Info func(idx int)
+}
+
+func InitChatHistory(workingSession *types.WorkingSession, handlers ChatHistoryHandlers) *tview.TextView {
 	chatHistory := tview.NewTextView()
 	chatHistory.
+		SetRegions(true).
 		SetBorder(true).
 		SetTitle("History")
-	RenderChatHistory(chatHistory, workingSession.Messages)
+	// p/n to select the previous/next message, Escape to clear the selection.
+	// e edits the selected question, [ and ] go to its sibling branches, i shows
+	// when and by what the selected message was written.
+	chatHistory.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			chatHistory.Highlight()
+			return nil
+		}
+		if event.Key() != tcell.KeyRune {
+			return event
+		}
+		switch event.Rune() {
+		case 'p':
+			moveSelection(chatHistory, -1)
+			return nil
+		case 'n':
+			moveSelection(chatHistory, 1)
+			return nil
+		case 'e':
+			if idx := SelectedMessage(chatHistory); idx >= 0 && handlers.Edit != nil {
+				handlers.Edit(idx)
+			}
+			return nil
+		case 'i':
+			if idx := SelectedMessage(chatHistory); idx >= 0 && handlers.Info != nil {
+				handlers.Info(idx)
+			}
+			return nil
+		case '[', ']':
+			delta := 1
+			if event.Rune() == '[' {
+				delta = -1
+			}
+			if idx := SelectedMessage(chatHistory); idx >= 0 && handlers.SwitchBranch != nil {
+				handlers.SwitchBranch(idx, delta)
+			}
+			return nil
+		}
+		return event
+	})
+	RenderChatHistory(chatHistory, workingSession)
 	return chatHistory
 }
 
-func RenderChatHistory(chatHistory *tview.TextView, messages []types.Message) {
+// SelectedMessage returns the index of the selected message, or -1 if none is selected
+func SelectedMessage(chatHistory *tview.TextView) int {
+	highlights := chatHistory.GetHighlights()
+	if len(highlights) == 0 {
+		return -1
+	}
+	idx, err := strconv.Atoi(strings.TrimPrefix(highlights[0], messageRegionPrefix))
+	if err != nil {
+		return -1
+	}
+	return idx
+}
+
+func SelectMessage(chatHistory *tview.TextView, idx int) {
+	if idx < 0 {
+		chatHistory.Highlight()
+		return
+	}
+	chatHistory.Highlight(fmt.Sprintf("%s%d", messageRegionPrefix, idx))
+	chatHistory.ScrollToHighlight()
+}
+
+func moveSelection(chatHistory *tview.TextView, delta int) {
+	text := chatHistory.GetText(false)
+	count := 0
+	for strings.Contains(text, fmt.Sprintf(`["%s%d"]`, messageRegionPrefix, count)) {
+		count++
+	}
+	if count == 0 {
+		return
+	}
+	idx := SelectedMessage(chatHistory)
+	if idx < 0 {
+		idx = count
+	}
+	idx += delta
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= count {
+		idx = count - 1
+	}
+	SelectMessage(chatHistory, idx)
+}
+
+func renderMessage(msg types.Message) string {
+	if msg.Role == types.RoleUser {
+		return msg.Question
+	} else if msg.Role == types.RoleTool {
+		return fmt.Sprintf("[tool result: %d bytes]", len(msg.Content))
+	} else if len(msg.ToolCalls) > 0 {
+		calls := []string{}
+		if msg.Content != "" {
+			calls = append(calls, msg.Content)
+		}
+		for _, call := range msg.ToolCalls {
+			calls = append(calls, fmt.Sprintf("[tool call: %s(%s)]", call.Function.Name, call.Function.Arguments))
+		}
+		return strings.Join(calls, "\n")
+	}
+	return msg.Content
+}
+
+func RenderChatHistory(chatHistory *tview.TextView, workingSession *types.WorkingSession) {
 	msgsString := []string{}
-	for _, msg := range messages {
-		if msg.Role == "user" {
-			msgsString = append(msgsString, msg.Question)
-		} else {
-			msgsString = append(msgsString, msg.Content)
+	siblings, positions := workingSession.BranchSiblings()
+	for i, msg := range workingSession.Messages {
+		text := tview.Escape(renderMessage(msg))
+		if len(siblings[i]) > 1 {
+			text = fmt.Sprintf("[::d]%s[::-]\n%s", tview.Escape(fmt.Sprintf("[branch %d/%d]", positions[i]+1, len(siblings[i]))), text)
 		}
+		msgsString = append(msgsString, fmt.Sprintf(`["%s%d"]%s[""]`, messageRegionPrefix, i, text))
 	}
 	chatHistory.SetText(strings.Join(msgsString, "\n\n---\n"))
-	chatHistory.ScrollToEnd()
+	if SelectedMessage(chatHistory) >= 0 {
+		chatHistory.ScrollToHighlight()
+	} else {
+		chatHistory.ScrollToEnd()
+	}
+}
+
+// MessageInfo describes when and by what a message was written, and the tokens it used
+func MessageInfo(msg types.Message) string {
+	lines := []string{fmt.Sprintf("Role: %s", msg.Role)}
+	if msg.Time != nil {
+		lines = append(lines, fmt.Sprintf("Time: %s", msg.Time.Local().Format("2006-01-02 15:04:05")))
+	}
+	if msg.Model != "" {
+		model := msg.Model
+		if msg.Provider != "" {
+			model = msg.Provider + "/" + model
+		}
+		lines = append(lines, fmt.Sprintf("Model: %s", model))
+	}
+	if msg.TimeToFirstToken > 0 {
+		lines = append(lines, fmt.Sprintf("Time to first token: %s", msg.TimeToFirstToken.Round(time.Millisecond)))
+	}
+	if msg.Duration > 0 {
+		lines = append(lines, fmt.Sprintf("Duration: %s", msg.Duration.Round(time.Millisecond)))
+	}
+	if msg.Usage != nil {
+		lines = append(lines, fmt.Sprintf("Tokens: %d prompt + %d completion = %d",
+			msg.Usage.PromptTokens, msg.Usage.CompletionTokens, msg.Usage.TotalTokens))
+	}
+	return strings.Join(lines, "\n")
 }
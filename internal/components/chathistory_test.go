@@ -0,0 +1,30 @@
+package components
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func TestMessageInfo(t *testing.T) {
+	msg := types.Message{
+		AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem, Content: "Hi"},
+		Provider:         "openai",
+		Model:            "gpt-4o",
+		TimeToFirstToken: 312 * time.Millisecond,
+		Duration:         2500 * time.Millisecond,
+		Usage:            &types.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}
+	info := MessageInfo(msg)
+	for _, expected := range []string{"Model: openai/gpt-4o", "Time to first token: 312ms", "Duration: 2.5s", "10 prompt + 5 completion = 15"} {
+		if !strings.Contains(info, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, info)
+		}
+	}
+	// Old messages only have a role
+	if info := MessageInfo(types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser}}); info != "Role: user" {
+		t.Errorf("Unexpected info for a message without metadata: %q", info)
+	}
+}
@@ -0,0 +1,70 @@
+package components
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ComparisonView shows the answers of several models side by side
+type ComparisonView struct {
+	*tview.Flex
+	panes []*tview.TextView
+	done  []bool
+}
+
+// NewComparisonView shows one pane per model. Left/Right move between panes, 1-9 choose
+// the answer of a finished pane and Escape cancels.
+func NewComparisonView(app *tview.Application, models []string, choose func(i int), cancel func()) *ComparisonView {
+	view := &ComparisonView{
+		Flex: tview.NewFlex(),
+		done: make([]bool, len(models)),
+	}
+	for i, model := range models {
+		pane := tview.NewTextView().SetWrap(true).SetWordWrap(true)
+		pane.SetBorder(true).SetTitle(fmt.Sprintf("%d: %s", i+1, model))
+		view.panes = append(view.panes, pane)
+		view.AddItem(pane, 0, 1, i == 0)
+	}
+	focused := 0
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			cancel()
+			return nil
+		case tcell.KeyLeft, tcell.KeyRight:
+			if event.Key() == tcell.KeyLeft {
+				focused = (focused + len(view.panes) - 1) % len(view.panes)
+			} else {
+				focused = (focused + 1) % len(view.panes)
+			}
+			app.SetFocus(view.panes[focused])
+			return nil
+		case tcell.KeyRune:
+			i := int(event.Rune() - '1')
+			if i >= 0 && i < len(view.panes) && view.done[i] {
+				choose(i)
+			}
+			return nil
+		}
+		return event
+	})
+	return view
+}
+
+func (view *ComparisonView) SetContent(i int, content string) {
+	view.panes[i].SetText(tview.Escape(content))
+	view.panes[i].ScrollToEnd()
+}
+
+// SetDone marks the answer in pane i as finished, so it can be chosen
+func (view *ComparisonView) SetDone(i int) {
+	view.done[i] = true
+	view.panes[i].SetTitle(view.panes[i].GetTitle() + " (done, press " + fmt.Sprint(i+1) + " to choose)")
+}
+
+// SetFailed marks the answer in pane i as failed, it can't be chosen
+func (view *ComparisonView) SetFailed(i int) {
+	view.panes[i].SetTitle(view.panes[i].GetTitle() + " (failed)")
+}
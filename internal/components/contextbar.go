@@ -23,7 +23,11 @@ func NewContextBar(workingFiles *[]types.WorkingFile) (contextBar *ContextBar) {
 func (contextBar ContextBar) Render(wf []types.WorkingFile) {
 	s := []string{}
 	for _, f := range wf {
-		s = append(s, f.Path)
+		if f.McpServer != "" {
+			s = append(s, f.McpServer+":"+f.Path)
+		} else {
+			s = append(s, f.Path)
+		}
 	}
 	contextBar.SetText(strings.Join(s, " | "))
 }
@@ -0,0 +1,20 @@
+package components
+
+import "strings"
+
+// FuzzyMatch tells whether the letters of pattern appear in order in s, ignoring case
+func FuzzyMatch(pattern string, s string) bool {
+	pattern = strings.ToLower(pattern)
+	s = strings.ToLower(s)
+	for _, r := range pattern {
+		if r == ' ' {
+			continue
+		}
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
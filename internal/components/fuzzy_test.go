@@ -0,0 +1,23 @@
+package components
+
+import "testing"
+
+func TestFuzzyMatch(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		s        string
+		expected bool
+	}{
+		{"", "anything", true},
+		{"rvw", "review", true},
+		{"RevIew", "code review", true},
+		{"wer", "review", false},
+		{"des chat", "design-chat", true},
+		{"é", "café", true},
+	}
+	for _, c := range cases {
+		if got := FuzzyMatch(c.pattern, c.s); got != c.expected {
+			t.Errorf("FuzzyMatch(%q, %q) = %v, expected %v", c.pattern, c.s, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package components
+
+import "github.com/rivo/tview"
+
+// Centered wraps a primitive so that it is shown centered with a fixed size, for use as a modal page
+func Centered(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
+		AddItem(nil, 0, 1, false)
+}
@@ -0,0 +1,35 @@
+package components
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type PickerItem struct {
+	Text      string
+	Secondary string
+	Selected  func()
+}
+
+// NewPicker shows a list of items. Enter runs the item's Selected func, Escape closes the picker.
+func NewPicker(title string, items []PickerItem, close func()) *tview.List {
+	list := tview.NewList()
+	for _, item := range items {
+		list.AddItem(item.Text, item.Secondary, 0, item.Selected)
+	}
+	if len(items) == 0 {
+		list.AddItem("Nothing here", "", 0, nil)
+	}
+	list.SetDoneFunc(close)
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			close()
+			return nil
+		}
+		return event
+	})
+	list.
+		SetBorder(true).
+		SetTitle(title)
+	return list
+}
@@ -0,0 +1,22 @@
+package components
+
+import "github.com/rivo/tview"
+
+// NewPromptDialog asks for a single line of text. Escape cancels.
+func NewPromptDialog(title string, label string, initial string, done func(value string, ok bool)) *tview.Form {
+	form := tview.NewForm()
+	form.AddInputField(label, initial, 0, nil, nil)
+	form.AddButton("OK", func() {
+		done(form.GetFormItemByLabel(label).(*tview.InputField).GetText(), true)
+	})
+	form.AddButton("Cancel", func() {
+		done("", false)
+	})
+	form.SetCancelFunc(func() {
+		done("", false)
+	})
+	form.
+		SetBorder(true).
+		SetTitle(title)
+	return form
+}
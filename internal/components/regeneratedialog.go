@@ -0,0 +1,36 @@
+package components
+
+import "github.com/rivo/tview"
+
+type RegenerateSettings struct {
+	Model string
+	// Empty means the API default
+	Temperature string
+	// Keep the old answer as an alternative
+	Keep bool
+}
+
+// NewRegenerateDialog asks how to regenerate the last answer. Escape cancels.
+func NewRegenerateDialog(initial RegenerateSettings, done func(settings RegenerateSettings, ok bool)) *tview.Form {
+	form := tview.NewForm()
+	form.AddInputField("Model", initial.Model, 0, nil, nil)
+	form.AddInputField("Temperature", initial.Temperature, 0, nil, nil)
+	form.AddCheckbox("Keep old answer", initial.Keep, nil)
+	form.AddButton("Regenerate", func() {
+		done(RegenerateSettings{
+			Model:       form.GetFormItemByLabel("Model").(*tview.InputField).GetText(),
+			Temperature: form.GetFormItemByLabel("Temperature").(*tview.InputField).GetText(),
+			Keep:        form.GetFormItemByLabel("Keep old answer").(*tview.Checkbox).IsChecked(),
+		}, true)
+	})
+	form.AddButton("Cancel", func() {
+		done(initial, false)
+	})
+	form.SetCancelFunc(func() {
+		done(initial, false)
+	})
+	form.
+		SetBorder(true).
+		SetTitle("Regenerate the last answer")
+	return form
+}
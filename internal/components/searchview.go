@@ -0,0 +1,65 @@
+package components
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type SearchResult struct {
+	Session string
+	Role    string
+	Snippet string
+}
+
+// SearchView has a query field over a list of results. Enter in the field
+// searches, Enter in the list opens the result and Esc closes.
+type SearchView struct {
+	*tview.Flex
+	query   *tview.InputField
+	results *tview.List
+}
+
+func NewSearchView(app *tview.Application, search func(query string) []SearchResult, open func(i int), close func()) *SearchView {
+	view := &SearchView{
+		Flex:    tview.NewFlex().SetDirection(tview.FlexRow),
+		query:   tview.NewInputField().SetLabel("Search: "),
+		results: tview.NewList(),
+	}
+	view.AddItem(view.query, 1, 0, true).
+		AddItem(view.results, 0, 1, false)
+	view.
+		SetBorder(true).
+		SetTitle("Search all sessions (Enter search/open, Tab switch, Esc close)")
+
+	view.query.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEscape:
+			close()
+		case tcell.KeyEnter:
+			view.results.Clear()
+			for _, result := range search(view.query.GetText()) {
+				view.results.AddItem(tview.Escape(result.Session+" ("+result.Role+")"), tview.Escape(result.Snippet), 0, nil)
+			}
+			if view.results.GetItemCount() > 0 {
+				app.SetFocus(view.results)
+			}
+		case tcell.KeyTab:
+			app.SetFocus(view.results)
+		}
+	})
+	view.results.SetSelectedFunc(func(i int, _ string, _ string, _ rune) {
+		open(i)
+	})
+	view.results.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			close()
+			return nil
+		case tcell.KeyTab, tcell.KeyBacktab:
+			app.SetFocus(view.query)
+			return nil
+		}
+		return event
+	})
+	return view
+}
@@ -0,0 +1,147 @@
+package components
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type SessionItem struct {
+	Name         string
+	Path         string
+	Title        string
+	ModTime      time.Time
+	MessageCount int
+	Model        string
+}
+
+type SessionBrowserHandlers struct {
+	Open      func(item SessionItem)
+	Create    func()
+	Rename    func(item SessionItem)
+	Duplicate func(item SessionItem)
+	Delete    func(item SessionItem)
+	Export    func(item SessionItem)
+	Close     func()
+}
+
+// SessionBrowser lists sessions with a fuzzy filter on top.
+// Keys in the list: Enter opens, n creates, r renames, d duplicates, x deletes, e exports,
+// / filters, Esc closes.
+type SessionBrowser struct {
+	*tview.Flex
+	filter   *tview.InputField
+	table    *tview.Table
+	items    []SessionItem
+	filtered []SessionItem
+	app      *tview.Application
+}
+
+func NewSessionBrowser(app *tview.Application, items []SessionItem, handlers SessionBrowserHandlers) *SessionBrowser {
+	browser := &SessionBrowser{
+		Flex:   tview.NewFlex().SetDirection(tview.FlexRow),
+		filter: tview.NewInputField().SetLabel("Filter: "),
+		table:  tview.NewTable().SetSelectable(true, false).SetFixed(1, 0),
+		app:    app,
+	}
+	browser.AddItem(browser.filter, 1, 0, false).
+		AddItem(browser.table, 0, 1, true)
+	browser.
+		SetBorder(true).
+		SetTitle("Sessions (Enter open, n new, r rename, d duplicate, x delete, e export, / filter, Esc close)")
+
+	browser.filter.SetChangedFunc(func(text string) {
+		browser.render()
+	})
+	browser.filter.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			handlers.Close()
+			return
+		}
+		app.SetFocus(browser.table)
+	})
+
+	browser.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			handlers.Close()
+			return nil
+		}
+		if event.Key() != tcell.KeyRune {
+			return event
+		}
+		if event.Rune() == '/' {
+			app.SetFocus(browser.filter)
+			return nil
+		}
+		if event.Rune() == 'n' {
+			handlers.Create()
+			return nil
+		}
+		item, ok := browser.selected()
+		if !ok {
+			return event
+		}
+		switch event.Rune() {
+		case 'r':
+			handlers.Rename(item)
+		case 'd':
+			handlers.Duplicate(item)
+		case 'x':
+			handlers.Delete(item)
+		case 'e':
+			handlers.Export(item)
+		default:
+			return event
+		}
+		return nil
+	})
+	browser.table.SetSelectedFunc(func(row, column int) {
+		if item, ok := browser.selected(); ok {
+			handlers.Open(item)
+		}
+	})
+
+	browser.SetItems(items)
+	return browser
+}
+
+func (browser *SessionBrowser) SetItems(items []SessionItem) {
+	browser.items = items
+	browser.render()
+}
+
+func (browser *SessionBrowser) selected() (SessionItem, bool) {
+	row, _ := browser.table.GetSelection()
+	if row < 1 || row > len(browser.filtered) {
+		return SessionItem{}, false
+	}
+	return browser.filtered[row-1], true
+}
+
+func (browser *SessionBrowser) render() {
+	pattern := browser.filter.GetText()
+	browser.filtered = []SessionItem{}
+	for _, item := range browser.items {
+		if FuzzyMatch(pattern, item.Name+" "+item.Title) {
+			browser.filtered = append(browser.filtered, item)
+		}
+	}
+
+	browser.table.Clear()
+	for col, header := range []string{"NAME", "TITLE", "MODIFIED", "MESSAGES", "MODEL"} {
+		browser.table.SetCell(0, col, tview.NewTableCell(header).SetSelectable(false).SetAttributes(tcell.AttrBold))
+	}
+	for i, item := range browser.filtered {
+		row := i + 1
+		browser.table.SetCell(row, 0, tview.NewTableCell(tview.Escape(item.Name)))
+		browser.table.SetCell(row, 1, tview.NewTableCell(tview.Escape(item.Title)).SetExpansion(1))
+		browser.table.SetCell(row, 2, tview.NewTableCell(item.ModTime.Format("2006-01-02 15:04")))
+		browser.table.SetCell(row, 3, tview.NewTableCell(fmt.Sprintf("%d", item.MessageCount)).SetAlign(tview.AlignRight))
+		browser.table.SetCell(row, 4, tview.NewTableCell(tview.Escape(item.Model)))
+	}
+	if len(browser.filtered) > 0 {
+		browser.table.Select(1, 0)
+	}
+}
@@ -0,0 +1,28 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+type TabBar struct {
+	*tview.TextView
+}
+
+func NewTabBar() *TabBar {
+	textView := tview.NewTextView().
+		SetRegions(true).
+		SetWrap(false)
+	return &TabBar{TextView: textView}
+}
+
+func (tabBar *TabBar) Render(names []string, active int) {
+	tabs := []string{}
+	for i, name := range names {
+		tabs = append(tabs, fmt.Sprintf(`["tab-%d"] %d:%s [""]`, i, i+1, tview.Escape(name)))
+	}
+	tabBar.SetText(strings.Join(tabs, "|"))
+	tabBar.Highlight(fmt.Sprintf("tab-%d", active))
+}
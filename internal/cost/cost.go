@@ -0,0 +1,125 @@
+// Package cost prices token usage and keeps track of what was spent, so that spending
+// limits can be enforced across sessions.
+package cost
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Price in USD per million tokens
+type Price struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// Prices by model. A dated model like gpt-4o-2024-08-06 is priced like the longest
+// model name that it starts with.
+type Prices map[string]Price
+
+// DefaultPrices are OpenAI's list prices. The config can add models or override them.
+var DefaultPrices = Prices{
+	"gpt-4o":        {Input: 2.50, Output: 10.00},
+	"gpt-4o-mini":   {Input: 0.15, Output: 0.60},
+	"gpt-4.1":       {Input: 2.00, Output: 8.00},
+	"gpt-4.1-mini":  {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano":  {Input: 0.10, Output: 0.40},
+	"gpt-4-turbo":   {Input: 10.00, Output: 30.00},
+	"gpt-3.5-turbo": {Input: 0.50, Output: 1.50},
+	"o1":            {Input: 15.00, Output: 60.00},
+	"o1-mini":       {Input: 1.10, Output: 4.40},
+	"o3-mini":       {Input: 1.10, Output: 4.40},
+}
+
+// A soft limit warns before submitting, a hard limit refuses to. Zero means no limit.
+type Limit struct {
+	Soft float64 `yaml:"soft,omitempty"`
+	Hard float64 `yaml:"hard,omitempty"`
+}
+
+type Limits struct {
+	Session Limit `yaml:"session,omitempty"`
+	Daily   Limit `yaml:"daily,omitempty"`
+	Project Limit `yaml:"project,omitempty"`
+}
+
+type Config struct {
+	Prices Prices `yaml:"prices,omitempty"`
+	Limits Limits `yaml:"limits,omitempty"`
+}
+
+// With returns the prices with the given ones added or overriding
+func (prices Prices) With(overrides Prices) Prices {
+	merged := Prices{}
+	for model, price := range prices {
+		merged[model] = price
+	}
+	for model, price := range overrides {
+		merged[model] = price
+	}
+	return merged
+}
+
+// Lookup finds the price of a model, false if it isn't known
+func (prices Prices) Lookup(model string) (Price, bool) {
+	if price, ok := prices[model]; ok {
+		return price, true
+	}
+	best := ""
+	for name := range prices {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best = name
+		}
+	}
+	price, ok := prices[best]
+	return price, ok
+}
+
+// Cost of a completion in USD, false if the model has no price
+func (prices Prices) Cost(model string, usage types.Usage) (float64, bool) {
+	price, ok := prices.Lookup(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1e6, true
+}
+
+// What has been spent in a session, today and in a project
+type Totals struct {
+	Session float64
+	Daily   float64
+	Project float64
+}
+
+// Check compares the totals to the limits. Soft limits that are reached give
+// warnings, a hard limit that is reached gives an error.
+func (limits Limits) Check(totals Totals) (warnings []string, err error) {
+	checks := []struct {
+		name  string
+		spent float64
+		limit Limit
+	}{
+		{"session", totals.Session, limits.Session},
+		{"daily", totals.Daily, limits.Daily},
+		{"project", totals.Project, limits.Project},
+	}
+	for _, c := range checks {
+		if c.limit.Hard > 0 && c.spent >= c.limit.Hard {
+			return warnings, fmt.Errorf("%s spending of %s has reached the hard limit of %s", c.name, Format(c.spent), Format(c.limit.Hard))
+		}
+		if c.limit.Soft > 0 && c.spent >= c.limit.Soft {
+			warnings = append(warnings, fmt.Sprintf("%s spending of %s has reached the soft limit of %s", c.name, Format(c.spent), Format(c.limit.Soft)))
+		}
+	}
+	return warnings, nil
+}
+
+// Format gives an amount in USD, with more decimals for small amounts
+func Format(amount float64) string {
+	if amount < 1 {
+		return fmt.Sprintf("$%.4f", amount)
+	}
+	return fmt.Sprintf("$%.2f", amount)
+}
@@ -0,0 +1,64 @@
+package cost
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func TestCost(t *testing.T) {
+	prices := DefaultPrices.With(Prices{"local-llama": {Input: 0, Output: 0}, "gpt-4o": {Input: 5, Output: 15}})
+
+	cost, ok := prices.Cost("gpt-4o-2024-08-06", types.Usage{PromptTokens: 1000, CompletionTokens: 100})
+	assert.True(t, ok)
+	assert.InDelta(t, 0.0065, cost, 1e-9)
+
+	// The longest matching name wins
+	price, ok := prices.Lookup("gpt-4o-mini-2024-07-18")
+	assert.True(t, ok)
+	assert.Equal(t, DefaultPrices["gpt-4o-mini"], price)
+
+	_, ok = prices.Cost("unknown-model", types.Usage{PromptTokens: 1})
+	assert.False(t, ok)
+	_, ok = prices.Lookup("gpt-4")
+	assert.False(t, ok)
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{Daily: Limit{Soft: 1, Hard: 5}, Session: Limit{Soft: 0.5}}
+
+	warnings, err := limits.Check(Totals{Session: 0.1, Daily: 0.2})
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	warnings, err = limits.Check(Totals{Session: 0.6, Daily: 1.5})
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 2)
+
+	_, err = limits.Check(Totals{Daily: 5})
+	assert.ErrorContains(t, err, "daily spending of $5.00 has reached the hard limit of $5.00")
+}
+
+func TestLedger(t *testing.T) {
+	ledger := OpenLedger(filepath.Join(t.TempDir(), "spending.jsonl"))
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.Local)
+
+	totals, err := ledger.Totals("review", "/src/cir", now)
+	assert.NoError(t, err)
+	assert.Equal(t, Totals{}, totals)
+
+	entries := []Entry{
+		{Time: now, Session: "review", Project: "/src/cir", Cost: 0.25},
+		{Time: now.Add(-time.Hour), Session: "design", Project: "/src/cir", Cost: 0.5},
+		{Time: now.AddDate(0, 0, -1), Session: "review", Project: "/src/other", Cost: 1},
+	}
+	for _, entry := range entries {
+		assert.NoError(t, ledger.Add(entry))
+	}
+	totals, err = ledger.Totals("review", "/src/cir", now)
+	assert.NoError(t, err)
+	assert.Equal(t, Totals{Session: 1.25, Daily: 0.75, Project: 0.75}, totals)
+}
@@ -0,0 +1,84 @@
+package cost
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// A priced completion. The cost is kept as it was priced then, so changing the
+// prices doesn't change what was spent.
+type Entry struct {
+	Time             time.Time `json:"time"`
+	Session          string    `json:"session"`
+	Project          string    `json:"project"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"`
+}
+
+// Ledger is a file with one JSON entry per line. Several cir processes may append
+// to it at once, so totals are read from the file rather than kept in memory.
+type Ledger struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func OpenLedger(path string) *Ledger {
+	return &Ledger{path: path}
+}
+
+func (ledger *Ledger) Add(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
+	f, err := os.OpenFile(ledger.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	// A single write of a whole line, so lines from other processes don't interleave
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Totals sums what was spent in a session, on the day of now in local time and in
+// a project. A missing ledger means nothing was spent.
+func (ledger *Ledger) Totals(session string, project string, now time.Time) (Totals, error) {
+	totals := Totals{}
+	f, err := os.Open(ledger.path)
+	if os.IsNotExist(err) {
+		return totals, nil
+	}
+	if err != nil {
+		return totals, err
+	}
+	defer f.Close()
+	year, month, day := now.Local().Date()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A line cut short by a crash
+			continue
+		}
+		if entry.Session == session {
+			totals.Session += entry.Cost
+		}
+		if entry.Project == project {
+			totals.Project += entry.Cost
+		}
+		if y, m, d := entry.Time.Local().Date(); y == year && m == month && d == day {
+			totals.Daily += entry.Cost
+		}
+	}
+	return totals, scanner.Err()
+}
@@ -0,0 +1,49 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+type Func func(w io.Writer, title string, workingSession *types.WorkingSession) error
+
+var formats = map[string]Func{
+	"md":   Markdown,
+	"html": HTML,
+	"json": JSON,
+}
+
+// Formats lists the format names
+func Formats() []string {
+	names := []string{}
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Format looks up an export format by name
+func Format(name string) (Func, error) {
+	if f, ok := formats[name]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q, use one of %s", name, strings.Join(Formats(), ", "))
+}
+
+// FormatForPath picks the format from the file extension, Markdown if there is none
+func FormatForPath(path string) (Func, error) {
+	switch ext := strings.TrimPrefix(filepath.Ext(path), "."); ext {
+	case "", "markdown":
+		return Markdown, nil
+	case "htm":
+		return HTML, nil
+	default:
+		return Format(ext)
+	}
+}
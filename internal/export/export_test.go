@@ -0,0 +1,42 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func TestHTMLHighlightsCode(t *testing.T) {
+	workingSession := &types.WorkingSession{
+		Messages: []types.Message{
+			{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser}, Question: "How do I print <b>?"},
+			{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem, Content: "Like this:\n\n```go\nfmt.Println(\"<b>\")\n```\n\nDone."}},
+		},
+	}
+	var out bytes.Buffer
+	assert.NoError(t, HTML(&out, "Printing", workingSession))
+	html := out.String()
+
+	assert.Contains(t, html, "<title>Printing</title>")
+	assert.Contains(t, html, "How do I print &lt;b&gt;?")
+	assert.Contains(t, html, `<pre class="chroma">`)
+	assert.Contains(t, html, "Done.")
+	assert.NotContains(t, html, "```")
+	assert.False(t, strings.Contains(html, "<b>"), "Expected the text to be escaped")
+}
+
+func TestFormatForPath(t *testing.T) {
+	workingSession := &types.WorkingSession{}
+	for path, prefix := range map[string]string{"a.md": "# a", "a": "# a", "a.htm": "<!DOCTYPE html>", "a.json": "{"} {
+		f, err := FormatForPath(path)
+		assert.NoError(t, err)
+		var out bytes.Buffer
+		assert.NoError(t, f(&out, "a", workingSession))
+		assert.True(t, strings.HasPrefix(out.String(), prefix), path)
+	}
+	_, err := FormatForPath("a.pdf")
+	assert.Error(t, err)
+}
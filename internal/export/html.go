@@ -0,0 +1,159 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+const highlightStyle = "github"
+
+// A fenced code block, with the language if given
+var codeBlockRegexp = regexp.MustCompile("(?ms)^```([\\w+#.-]*)[^\\n]*\\n(.*?)^```[ \\t]*$")
+
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+.text { white-space: pre-wrap; }
+.question { background: #f3f6fa; border-left: 4px solid #0969da; padding: 0.5em 1em; }
+.tool { color: #57606a; }
+pre { overflow-x: auto; padding: 0.5em; }
+code { font-family: monospace; }
+{{.CSS}}
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Messages}}
+{{- if eq .Kind "question"}}
+<h2>Question</h2>
+<div class="question">{{.Body}}</div>
+{{- if .Files}}
+<p>Attached files: {{range $i, $f := .Files}}{{if $i}}, {{end}}<code>{{$f}}</code>{{end}}</p>
+{{- end}}
+{{- else if eq .Kind "tool_result"}}
+<details class="tool"><summary>Tool result</summary><pre>{{.Text}}</pre></details>
+{{- else if eq .Kind "tool_calls"}}
+{{.Body}}
+{{- range .ToolCalls}}
+<p class="tool"><em>Tool call: <code>{{.Function.Name}}({{.Function.Arguments}})</code></em></p>
+{{- end}}
+{{- else}}
+<h2>Answer</h2>
+{{.Body}}
+{{- end}}
+{{end}}
+{{- if .WorkingFiles}}
+<h2>Working set</h2>
+<ul>
+{{- range .WorkingFiles}}
+<li><code>{{.}}</code></li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+type htmlMessage struct {
+	Kind      string
+	Text      string
+	Body      template.HTML
+	Files     []string
+	ToolCalls []types.ToolCall
+}
+
+// HTML writes a standalone page of the questions, answers and attached files of a
+// session. Fenced code blocks are highlighted.
+func HTML(w io.Writer, title string, workingSession *types.WorkingSession) error {
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+	style := styles.Get(highlightStyle)
+	var css bytes.Buffer
+	if err := formatter.WriteCSS(&css, style); err != nil {
+		return err
+	}
+
+	messages := []htmlMessage{}
+	for _, msg := range workingSession.Messages {
+		var m htmlMessage
+		var err error
+		switch {
+		case msg.Role == types.RoleUser:
+			m = htmlMessage{Kind: "question"}
+			m.Body, err = renderText(formatter, style, msg.Question)
+			for _, wf := range msg.IncludedWorkingFiles {
+				m.Files = append(m.Files, wf.Path)
+			}
+		case msg.Role == types.RoleTool:
+			m = htmlMessage{Kind: "tool_result", Text: msg.Content}
+		case len(msg.ToolCalls) > 0:
+			m = htmlMessage{Kind: "tool_calls", ToolCalls: msg.ToolCalls}
+			m.Body, err = renderText(formatter, style, msg.Content)
+		default:
+			m = htmlMessage{Kind: "answer"}
+			m.Body, err = renderText(formatter, style, msg.Content)
+		}
+		if err != nil {
+			return err
+		}
+		messages = append(messages, m)
+	}
+	workingFiles := []string{}
+	for _, wf := range workingSession.WorkingFiles {
+		workingFiles = append(workingFiles, wf.Path)
+	}
+
+	return htmlTemplate.Execute(w, map[string]interface{}{
+		"Title":        title,
+		"CSS":          template.CSS(css.String()),
+		"Messages":     messages,
+		"WorkingFiles": workingFiles,
+	})
+}
+
+// Render text as escaped, whitespace preserving blocks with highlighted code blocks in between
+func renderText(formatter *chromahtml.Formatter, style *chroma.Style, text string) (template.HTML, error) {
+	var b strings.Builder
+	writeText := func(s string) {
+		if s = strings.Trim(s, "\n"); s != "" {
+			fmt.Fprintf(&b, "<div class=\"text\">%s</div>\n", template.HTMLEscapeString(s))
+		}
+	}
+	last := 0
+	for _, match := range codeBlockRegexp.FindAllStringSubmatchIndex(text, -1) {
+		writeText(text[last:match[0]])
+		last = match[1]
+		language, code := text[match[2]:match[3]], text[match[4]:match[5]]
+
+		lexer := lexers.Get(language)
+		if lexer == nil {
+			lexer = lexers.Analyse(code)
+		}
+		if lexer == nil {
+			lexer = lexers.Fallback
+		}
+		iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+		if err != nil {
+			return "", err
+		}
+		if err := formatter.Format(&b, style, iterator); err != nil {
+			return "", err
+		}
+		b.WriteString("\n")
+	}
+	writeText(text[last:])
+	return template.HTML(b.String()), nil
+}
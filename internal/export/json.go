@@ -0,0 +1,65 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+type jsonMessage struct {
+	ID            int              `json:"id"`
+	Parent        int              `json:"parent,omitempty"`
+	Role          string           `json:"role"`
+	Content       string           `json:"content"`
+	Question      string           `json:"question,omitempty"`
+	AttachedFiles []string         `json:"attached_files,omitempty"`
+	ToolCalls     []types.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID    string           `json:"tool_call_id,omitempty"`
+	Time          *time.Time       `json:"time,omitempty"`
+	Model         string           `json:"model,omitempty"`
+	Usage         *types.Usage     `json:"usage,omitempty"`
+}
+
+type jsonSession struct {
+	Title        string        `json:"title"`
+	Model        string        `json:"model,omitempty"`
+	Messages     []jsonMessage `json:"messages"`
+	WorkingFiles []string      `json:"working_files"`
+}
+
+// JSON writes the current branch of a session for other tools. Content is what
+// was sent to the model, question is what the user typed.
+func JSON(w io.Writer, title string, workingSession *types.WorkingSession) error {
+	session := jsonSession{
+		Title:        title,
+		Model:        workingSession.Model,
+		Messages:     []jsonMessage{},
+		WorkingFiles: []string{},
+	}
+	for _, msg := range workingSession.Messages {
+		m := jsonMessage{
+			ID:         msg.ID,
+			Parent:     msg.Parent,
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Question:   msg.Question,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+			Time:       msg.Time,
+			Model:      msg.Model,
+			Usage:      msg.Usage,
+		}
+		for _, wf := range msg.IncludedWorkingFiles {
+			m.AttachedFiles = append(m.AttachedFiles, wf.Path)
+		}
+		session.Messages = append(session.Messages, m)
+	}
+	for _, wf := range workingSession.WorkingFiles {
+		session.WorkingFiles = append(session.WorkingFiles, wf.Path)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(session)
+}
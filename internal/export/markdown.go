@@ -0,0 +1,48 @@
+// Package export renders working sessions in formats meant for people and other tools
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Markdown writes the questions, answers and attached files of a session
+func Markdown(w io.Writer, title string, workingSession *types.WorkingSession) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", title)
+	for _, msg := range workingSession.Messages {
+		switch {
+		case msg.Role == types.RoleUser:
+			fmt.Fprintf(&b, "\n## Question\n\n%s\n", msg.Question)
+			if len(msg.IncludedWorkingFiles) > 0 {
+				paths := []string{}
+				for _, wf := range msg.IncludedWorkingFiles {
+					paths = append(paths, "`"+wf.Path+"`")
+				}
+				fmt.Fprintf(&b, "\nAttached files: %s\n", strings.Join(paths, ", "))
+			}
+		case msg.Role == types.RoleTool:
+			fmt.Fprintf(&b, "\n<details><summary>Tool result</summary>\n\n```\n%s\n```\n\n</details>\n", msg.Content)
+		case len(msg.ToolCalls) > 0:
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "\n%s\n", msg.Content)
+			}
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&b, "\n_Tool call: `%s(%s)`_\n", call.Function.Name, call.Function.Arguments)
+			}
+		default:
+			fmt.Fprintf(&b, "\n## Answer\n\n%s\n", msg.Content)
+		}
+	}
+	if len(workingSession.WorkingFiles) > 0 {
+		b.WriteString("\n## Working set\n\n")
+		for _, wf := range workingSession.WorkingFiles {
+			fmt.Fprintf(&b, "- `%s`\n", wf.Path)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
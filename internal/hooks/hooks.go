@@ -0,0 +1,147 @@
+// Package hooks runs user configured executables at points in the chat lifecycle.
+//
+// A hook gets the payload as JSON on stdin. Exiting non-zero vetoes the event, with
+// stderr as the reason. Exiting zero with empty stdout lets the payload through as is.
+// A hook may also print a Result as JSON to veto or to rewrite the payload. Only the
+// fields of the payload the result has are rewritten.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+type Event string
+
+const (
+	PreSubmit     Event = "pre_submit"
+	PostResponse  Event = "post_response"
+	OnEditApplied Event = "on_edit_applied"
+)
+
+const defaultTimeout = 30 * time.Second
+
+type Hook struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args,omitempty"`
+	// Seconds, defaults to 30
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+type Config struct {
+	PreSubmit     []Hook `yaml:"pre_submit,omitempty"`
+	PostResponse  []Hook `yaml:"post_response,omitempty"`
+	OnEditApplied []Hook `yaml:"on_edit_applied,omitempty"`
+}
+
+type File struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+type Payload struct {
+	Event       Event  `json:"event"`
+	SessionFile string `json:"session_file"`
+	Question    string `json:"question"`
+	// Files sent as context with the question
+	Files []File `json:"files"`
+	// The model's answer, for post_response
+	Response string `json:"response,omitempty"`
+	// The command that was run and what it printed, for on_edit_applied
+	Command string `json:"command,omitempty"`
+	Output  string `json:"output,omitempty"`
+}
+
+type Result struct {
+	Veto    bool     `json:"veto"`
+	Reason  string   `json:"reason,omitempty"`
+	Payload *Payload `json:"payload,omitempty"`
+}
+
+type VetoError struct {
+	Command string
+	Reason  string
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("vetoed by hook %s: %s", e.Command, e.Reason)
+}
+
+func (config Config) hooksFor(event Event) []Hook {
+	switch event {
+	case PreSubmit:
+		return config.PreSubmit
+	case PostResponse:
+		return config.PostResponse
+	case OnEditApplied:
+		return config.OnEditApplied
+	}
+	return nil
+}
+
+// Run runs the hooks of an event in order, each one seeing the payload as rewritten
+// by the ones before it. It returns a *VetoError if a hook vetoes.
+func (config Config) Run(event Event, payload Payload) (Payload, error) {
+	payload.Event = event
+	for _, hook := range config.hooksFor(event) {
+		result, err := hook.run(payload)
+		if err != nil {
+			return payload, err
+		}
+		if result.Veto {
+			return payload, &VetoError{Command: hook.Command, Reason: result.Reason}
+		}
+		if result.Payload != nil {
+			rewritten := *result.Payload
+			rewritten.Event = event
+			payload = rewritten
+		}
+	}
+	return payload, nil
+}
+
+func (hook Hook) run(payload Payload) (Result, error) {
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return Result{}, err
+	}
+	timeout := defaultTimeout
+	if hook.Timeout > 0 {
+		timeout = time.Duration(hook.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook.Command, hook.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return Result{}, fmt.Errorf("hook %s timed out after %v", hook.Command, timeout)
+	}
+	if _, ok := err.(*exec.ExitError); ok {
+		return Result{Veto: true, Reason: strings.TrimSpace(stderr.String())}, nil
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("running hook %s: %w", hook.Command, err)
+	}
+
+	var result Result
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return result, nil
+	}
+	// Decoding onto the payload keeps the fields the hook leaves out
+	rewritten := payload
+	result.Payload = &rewritten
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return Result{}, fmt.Errorf("hook %s printed invalid JSON: %w", hook.Command, err)
+	}
+	return result, nil
+}
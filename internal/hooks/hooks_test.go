@@ -0,0 +1,58 @@
+package hooks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bashHook(script string) Hook {
+	return Hook{Command: "bash", Args: []string{"-c", script}}
+}
+
+func TestPassThrough(t *testing.T) {
+	config := Config{PreSubmit: []Hook{bashHook("cat > /dev/null")}}
+	payload, err := config.Run(PreSubmit, Payload{Question: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", payload.Question)
+	assert.Equal(t, PreSubmit, payload.Event)
+}
+
+func TestVetoByExitCode(t *testing.T) {
+	config := Config{PreSubmit: []Hook{bashHook("grep -q AKIA && { echo 'found an AWS key' >&2; exit 1; }; exit 0")}}
+
+	_, err := config.Run(PreSubmit, Payload{Question: "hi", Files: []File{{Path: ".env", Content: "KEY=AKIA1234"}}})
+	assert.EqualError(t, err, "vetoed by hook bash: found an AWS key")
+
+	_, err = config.Run(PreSubmit, Payload{Question: "hi"})
+	assert.NoError(t, err)
+}
+
+func TestRewriteIsSeenByNextHook(t *testing.T) {
+	config := Config{PreSubmit: []Hook{
+		bashHook(`echo '{"payload": {"question": "rewritten"}}'`),
+		bashHook(`grep -q rewritten || exit 1`),
+	}}
+	payload, err := config.Run(PreSubmit, Payload{Question: "original"})
+	assert.NoError(t, err)
+	assert.Equal(t, "rewritten", payload.Question)
+}
+
+func TestRewriteKeepsOtherFields(t *testing.T) {
+	config := Config{PreSubmit: []Hook{bashHook(`echo '{"payload": {"question": "rewritten"}}'`)}}
+	files := []File{{Path: "main.go", Content: "package main"}}
+	payload, err := config.Run(PreSubmit, Payload{Question: "original", Files: files})
+	assert.NoError(t, err)
+	assert.Equal(t, "rewritten", payload.Question)
+	assert.Equal(t, files, payload.Files)
+}
+
+func TestVetoByResult(t *testing.T) {
+	config := Config{PostResponse: []Hook{bashHook(`echo '{"veto": true, "reason": "nope"}'`)}}
+	_, err := config.Run(PostResponse, Payload{})
+	assert.EqualError(t, err, "vetoed by hook bash: nope")
+
+	// Hooks of other events don't run
+	_, err = config.Run(PreSubmit, Payload{})
+	assert.NoError(t, err)
+}
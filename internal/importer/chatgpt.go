@@ -0,0 +1,118 @@
+package importer
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// The conversations.json of a ChatGPT data export. Each conversation is a tree of
+// nodes, edited questions and regenerated answers are siblings.
+type chatGPTConversation struct {
+	Title       string                 `json:"title"`
+	CreateTime  float64                `json:"create_time"`
+	UpdateTime  float64                `json:"update_time"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+	CurrentNode string                 `json:"current_node"`
+}
+
+type chatGPTNode struct {
+	ID       string          `json:"id"`
+	Message  *chatGPTMessage `json:"message"`
+	Parent   *string         `json:"parent"`
+	Children []string        `json:"children"`
+}
+
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime *float64 `json:"create_time"`
+	Content    struct {
+		ContentType string          `json:"content_type"`
+		Parts       json.RawMessage `json:"parts"`
+		Text        string          `json:"text"`
+	} `json:"content"`
+	Metadata struct {
+		Hidden bool `json:"is_visually_hidden_from_conversation"`
+	} `json:"metadata"`
+}
+
+// ChatGPT converts the conversations.json of a ChatGPT data export, keeping
+// the branches. The branch that was open in ChatGPT is the current one.
+func ChatGPT(data []byte) ([]Conversation, error) {
+	var exported []chatGPTConversation
+	if err := json.Unmarshal(data, &exported); err != nil {
+		return nil, err
+	}
+	conversations := []Conversation{}
+	for _, c := range exported {
+		workingSession := chatGPTSession(c)
+		conversation := Conversation{
+			Title:   titleOf(c.Title, workingSession.Messages),
+			Session: workingSession,
+		}
+		if t := unixTime(c.UpdateTime); t != nil {
+			conversation.Updated = *t
+		} else {
+			conversation.Updated = lastTime(workingSession.Tree)
+		}
+		conversations = append(conversations, conversation)
+	}
+	sortByUpdated(conversations)
+	return conversations, nil
+}
+
+func chatGPTSession(c chatGPTConversation) *types.WorkingSession {
+	workingSession := &types.WorkingSession{}
+	// The cir message each node ends up under, skipped nodes map to their parent's
+	ids := map[string]int{}
+
+	var visit func(nodeID string, parent int)
+	visit = func(nodeID string, parent int) {
+		node, ok := c.Mapping[nodeID]
+		if !ok {
+			return
+		}
+		id := parent
+		if msg := node.Message; msg != nil && !msg.Metadata.Hidden {
+			role, ok := answerRole(msg.Author.Role)
+			text := contentText(msg.Content.Parts)
+			if text == "" {
+				text = msg.Content.Text
+			}
+			if ok && text != "" {
+				m := newMessage(role, text, nil)
+				if msg.CreateTime != nil {
+					m.Time = unixTime(*msg.CreateTime)
+				}
+				m.ID = len(workingSession.Tree) + 1
+				m.Parent = parent
+				workingSession.Tree = append(workingSession.Tree, m)
+				id = m.ID
+			}
+		}
+		ids[nodeID] = id
+		for _, child := range node.Children {
+			visit(child, id)
+		}
+	}
+
+	roots := []string{}
+	for nodeID, node := range c.Mapping {
+		if node.Parent == nil {
+			roots = append(roots, nodeID)
+		} else if _, ok := c.Mapping[*node.Parent]; !ok {
+			roots = append(roots, nodeID)
+		}
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		visit(root, 0)
+	}
+
+	workingSession.Head = ids[c.CurrentNode]
+	workingSession.Messages = workingSession.Branch(workingSession.Head)
+	return workingSession
+}
@@ -0,0 +1,173 @@
+// Package importer converts conversations exported from other chat tools into working sessions
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Supported formats
+const (
+	FormatChatGPT  = "chatgpt"
+	FormatLLM      = "llm"
+	FormatMessages = "messages"
+)
+
+type Conversation struct {
+	Title string
+	// Zero if unknown
+	Updated time.Time
+	Session *types.WorkingSession
+}
+
+// Import reads all conversations in an export. An empty format is detected from the data.
+func Import(data []byte, format string) ([]Conversation, error) {
+	if format == "" {
+		format = Detect(data)
+	}
+	switch format {
+	case FormatChatGPT:
+		return ChatGPT(data)
+	case FormatLLM:
+		return LLM(data)
+	case FormatMessages:
+		return Messages(data)
+	case "":
+		return nil, fmt.Errorf("unrecognized export format")
+	default:
+		return nil, fmt.Errorf("unknown format %q, use %s, %s or %s", format, FormatChatGPT, FormatLLM, FormatMessages)
+	}
+}
+
+// Detect guesses the format from the first conversation, or gives "" if it can't tell
+func Detect(data []byte) string {
+	var object map[string]json.RawMessage
+	if json.Unmarshal(data, &object) == nil {
+		if _, ok := object["messages"]; ok {
+			return FormatMessages
+		}
+		return ""
+	}
+	var list []map[string]json.RawMessage
+	if json.Unmarshal(data, &list) != nil || len(list) == 0 {
+		return ""
+	}
+	first := list[0]
+	switch {
+	case first["mapping"] != nil:
+		return FormatChatGPT
+	case first["response"] != nil && first["prompt"] != nil:
+		return FormatLLM
+	case first["role"] != nil, first["messages"] != nil:
+		return FormatMessages
+	}
+	return ""
+}
+
+// cir stores answers with the system role
+func answerRole(role string) (string, bool) {
+	switch role {
+	case "user":
+		return types.RoleUser, true
+	case "assistant":
+		return types.RoleSystem, true
+	}
+	// System prompts and tool output have no place in a cir session
+	return "", false
+}
+
+func newMessage(role string, text string, t *time.Time) types.Message {
+	msg := types.Message{
+		AiServiceMessage: types.AiServiceMessage{Role: role, Content: text},
+		Time:             t,
+	}
+	if role == types.RoleUser {
+		msg.Question = text
+	}
+	return msg
+}
+
+// A linear session, saved as a tree with a single branch
+func linearSession(messages []types.Message) *types.WorkingSession {
+	workingSession := &types.WorkingSession{Messages: messages}
+	workingSession.Sync()
+	return workingSession
+}
+
+func unixTime(seconds float64) *time.Time {
+	if seconds <= 0 {
+		return nil
+	}
+	t := time.Unix(0, int64(seconds*float64(time.Second))).UTC()
+	return &t
+}
+
+func titleOf(title string, messages []types.Message) string {
+	if title = strings.TrimSpace(title); title != "" {
+		return title
+	}
+	for _, msg := range messages {
+		if msg.Role == types.RoleUser {
+			return strings.Join(strings.Fields(msg.Question), " ")
+		}
+	}
+	return "Imported conversation"
+}
+
+func lastTime(messages []types.Message) time.Time {
+	var last time.Time
+	for _, msg := range messages {
+		if msg.Time != nil && msg.Time.After(last) {
+			last = *msg.Time
+		}
+	}
+	return last
+}
+
+// Text of message content that is either a string or a list of parts. Parts that
+// aren't text, like images, are replaced by a placeholder.
+func contentText(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var parts []json.RawMessage
+	if json.Unmarshal(raw, &parts) != nil {
+		return ""
+	}
+	texts := []string{}
+	for _, part := range parts {
+		if json.Unmarshal(part, &s) == nil {
+			if s != "" {
+				texts = append(texts, s)
+			}
+			continue
+		}
+		var object struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(part, &object) == nil && object.Text != "" {
+			texts = append(texts, object.Text)
+		} else {
+			texts = append(texts, "[non-text content]")
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func sortByUpdated(conversations []Conversation) {
+	sort.SliceStable(conversations, func(i, j int) bool {
+		return conversations[i].Updated.Before(conversations[j].Updated)
+	})
+}
@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// A question that was edited once, so the conversation has two branches
+const chatGPTExport = `[{
+  "title": "Rotating logs",
+  "create_time": 1700000000.5,
+  "update_time": 1700000100.0,
+  "current_node": "a2",
+  "mapping": {
+    "root": {"id": "root", "message": null, "parent": null, "children": ["sys"]},
+    "sys": {"id": "sys", "parent": "root", "children": ["q1", "q2"],
+      "message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": [""]},
+        "metadata": {"is_visually_hidden_from_conversation": true}}},
+    "q1": {"id": "q1", "parent": "sys", "children": ["a1"],
+      "message": {"author": {"role": "user"}, "create_time": 1700000001, "content": {"content_type": "text", "parts": ["How do I rotate logs?"]}}},
+    "a1": {"id": "a1", "parent": "q1", "children": [],
+      "message": {"author": {"role": "assistant"}, "create_time": 1700000002, "content": {"content_type": "text", "parts": ["Use logrotate."]}}},
+    "q2": {"id": "q2", "parent": "sys", "children": ["a2"],
+      "message": {"author": {"role": "user"}, "create_time": 1700000050, "content": {"content_type": "multimodal_text", "parts": [{"content_type": "image_asset_pointer"}, "How do I rotate logs daily?"]}}},
+    "a2": {"id": "a2", "parent": "q2", "children": [],
+      "message": {"author": {"role": "assistant"}, "create_time": 1700000051, "content": {"content_type": "text", "parts": ["Use logrotate with daily."]}}}
+  }
+}]`
+
+func TestChatGPT(t *testing.T) {
+	assert.Equal(t, FormatChatGPT, Detect([]byte(chatGPTExport)))
+	conversations, err := Import([]byte(chatGPTExport), "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(conversations))
+
+	c := conversations[0]
+	assert.Equal(t, "Rotating logs", c.Title)
+	assert.Equal(t, int64(1700000100), c.Updated.Unix())
+	assert.Equal(t, 4, len(c.Session.Tree))
+
+	// The branch that was open in ChatGPT is current
+	messages := c.Session.Messages
+	assert.Equal(t, 2, len(messages))
+	assert.Equal(t, types.RoleUser, messages[0].Role)
+	assert.Equal(t, "[non-text content]\nHow do I rotate logs daily?", messages[0].Question)
+	assert.Equal(t, types.RoleSystem, messages[1].Role)
+	assert.Equal(t, "Use logrotate with daily.", messages[1].Content)
+	assert.Equal(t, time.Unix(1700000051, 0).UTC(), *messages[1].Time)
+
+	siblings, pos := c.Session.Siblings(0)
+	assert.Equal(t, 2, len(siblings))
+	assert.Equal(t, 1, pos)
+}
+
+const llmExport = `[
+  {"id": "2", "model": "gpt-4o-mini", "prompt": "And in Go?", "response": "Use goroutines.", "conversation_id": "c1", "conversation_name": "Concurrency", "datetime_utc": "2024-05-01T10:01:00.000000"},
+  {"id": "1", "model": "gpt-4o-mini", "prompt": "What is concurrency?", "response": "Doing several things at once.", "conversation_id": "c1", "conversation_name": "Concurrency", "datetime_utc": "2024-05-01T10:00:00.000000"},
+  {"id": "3", "model": "gpt-4o", "prompt": "Hello", "response": "Hi!", "conversation_id": "c2", "datetime_utc": "2024-04-01T09:00:00.000000"}
+]`
+
+func TestLLM(t *testing.T) {
+	assert.Equal(t, FormatLLM, Detect([]byte(llmExport)))
+	conversations, err := Import([]byte(llmExport), "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(conversations))
+
+	// Oldest conversation first
+	assert.Equal(t, "Hello", conversations[0].Title)
+	c := conversations[1]
+	assert.Equal(t, "Concurrency", c.Title)
+	assert.Equal(t, "gpt-4o-mini", c.Session.Model)
+	assert.Equal(t, 4, len(c.Session.Messages))
+	assert.Equal(t, "What is concurrency?", c.Session.Messages[0].Question)
+	assert.Equal(t, "Use goroutines.", c.Session.Messages[3].Content)
+	assert.Equal(t, 2024, c.Session.Messages[3].Time.Year())
+}
+
+func TestMessages(t *testing.T) {
+	export := `{"messages": [
+	  {"role": "system", "content": "You are helpful."},
+	  {"role": "user", "content": [{"type": "text", "text": "Hi"}]},
+	  {"role": "assistant", "content": "Hello!"}
+	]}`
+	assert.Equal(t, FormatMessages, Detect([]byte(export)))
+	conversations, err := Import([]byte(export), "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(conversations))
+	assert.Equal(t, "Hi", conversations[0].Title)
+	assert.Equal(t, 2, len(conversations[0].Session.Messages))
+
+	_, err = Import([]byte(`{"foo": 1}`), "")
+	assert.Error(t, err)
+	_, err = Import([]byte(export), "claude")
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// An entry of `llm logs --json` from https://llm.datasette.io, one per prompt and response
+type llmLogEntry struct {
+	Model            string `json:"model"`
+	Prompt           string `json:"prompt"`
+	Response         string `json:"response"`
+	ConversationID   string `json:"conversation_id"`
+	ConversationName string `json:"conversation_name"`
+	DatetimeUTC      string `json:"datetime_utc"`
+}
+
+// LLM converts the output of `llm logs --json`, one conversation per conversation ID
+func LLM(data []byte) ([]Conversation, error) {
+	var entries []llmLogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	order := []string{}
+	grouped := map[string][]llmLogEntry{}
+	for _, entry := range entries {
+		if _, ok := grouped[entry.ConversationID]; !ok {
+			order = append(order, entry.ConversationID)
+		}
+		grouped[entry.ConversationID] = append(grouped[entry.ConversationID], entry)
+	}
+
+	conversations := []Conversation{}
+	for _, conversationID := range order {
+		entries := grouped[conversationID]
+		// llm lists the newest first
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].DatetimeUTC < entries[j].DatetimeUTC
+		})
+		messages := []types.Message{}
+		for _, entry := range entries {
+			t := llmTime(entry.DatetimeUTC)
+			messages = append(messages, newMessage(types.RoleUser, entry.Prompt, t))
+			messages = append(messages, newMessage(types.RoleSystem, entry.Response, t))
+		}
+		workingSession := linearSession(messages)
+		workingSession.Model = entries[len(entries)-1].Model
+		conversations = append(conversations, Conversation{
+			Title:   titleOf(entries[0].ConversationName, messages),
+			Updated: lastTime(messages),
+			Session: workingSession,
+		})
+	}
+	sortByUpdated(conversations)
+	return conversations, nil
+}
+
+func llmTime(s string) *time.Time {
+	s = strings.TrimSuffix(s, "Z")
+	t, err := time.Parse("2006-01-02T15:04:05.999999", s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
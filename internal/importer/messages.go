@@ -0,0 +1,51 @@
+package importer
+
+import (
+	"encoding/json"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// The OpenAI chat format that many tools save conversations in
+type messagesConversation struct {
+	Title    string                 `json:"title"`
+	Messages []messagesConversation `json:"messages"`
+	Role     string                 `json:"role"`
+	Content  json.RawMessage        `json:"content"`
+}
+
+// Messages converts conversations in the OpenAI chat format: an object with a
+// messages list, a list of such objects, or a bare list of messages
+func Messages(data []byte) ([]Conversation, error) {
+	var object messagesConversation
+	if err := json.Unmarshal(data, &object); err == nil {
+		return []Conversation{messagesToConversation(object)}, nil
+	}
+	var list []messagesConversation
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	if len(list) > 0 && list[0].Role != "" {
+		return []Conversation{messagesToConversation(messagesConversation{Messages: list})}, nil
+	}
+	conversations := []Conversation{}
+	for _, c := range list {
+		conversations = append(conversations, messagesToConversation(c))
+	}
+	return conversations, nil
+}
+
+func messagesToConversation(c messagesConversation) Conversation {
+	messages := []types.Message{}
+	for _, m := range c.Messages {
+		role, ok := answerRole(m.Role)
+		text := contentText(m.Content)
+		if ok && text != "" {
+			messages = append(messages, newMessage(role, text, nil))
+		}
+	}
+	return Conversation{
+		Title:   titleOf(c.Title, messages),
+		Session: linearSession(messages),
+	}
+}
@@ -0,0 +1,194 @@
+// Package mcp is a minimal Model Context Protocol client talking JSON-RPC 2.0 over stdio
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	ProtocolVersion = "2024-11-05"
+	requestTimeout  = 30 * time.Second
+)
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+type rpcMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  interface{}      `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+type Client struct {
+	Name string
+
+	cmd     *exec.Cmd
+	writer  io.WriteCloser
+	writeMu sync.Mutex
+
+	pendingMu sync.Mutex
+	nextID    int64
+	pending   map[int64]chan rpcMessage
+	closed    chan struct{}
+}
+
+// Start launches an MCP server and performs the initialization handshake
+func Start(name string, command string, args []string, env map[string]string) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	client := NewClient(name, stdout, stdin)
+	client.cmd = cmd
+	if err := client.Initialize(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("initializing mcp server %s: %w", name, err)
+	}
+	return client, nil
+}
+
+// NewClient creates a client on an existing connection. Call Initialize before use.
+func NewClient(name string, r io.Reader, w io.WriteCloser) *Client {
+	client := &Client{
+		Name:    name,
+		writer:  w,
+		pending: map[int64]chan rpcMessage{},
+		closed:  make(chan struct{}),
+	}
+	go client.readLoop(r)
+	return client
+}
+
+func (client *Client) readLoop(r io.Reader) {
+	defer close(client.closed)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("mcp %s: error decoding message: %v", client.Name, err)
+			continue
+		}
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			// We don't offer any client features such as sampling
+			client.send(rpcMessage{JSONRPC: "2.0", ID: msg.ID, Error: &rpcError{Code: -32601, Message: "method not found"}})
+		case msg.Method != "":
+			// Notifications are ignored
+		case msg.ID != nil:
+			var id int64
+			if err := json.Unmarshal(*msg.ID, &id); err != nil {
+				continue
+			}
+			client.pendingMu.Lock()
+			ch, ok := client.pending[id]
+			delete(client.pending, id)
+			client.pendingMu.Unlock()
+			if ok {
+				ch <- msg
+			}
+		}
+	}
+}
+
+func (client *Client) send(msg rpcMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	client.writeMu.Lock()
+	defer client.writeMu.Unlock()
+	_, err = client.writer.Write(append(data, '\n'))
+	return err
+}
+
+func (client *Client) call(method string, params interface{}, result interface{}) error {
+	client.pendingMu.Lock()
+	client.nextID++
+	id := client.nextID
+	ch := make(chan rpcMessage, 1)
+	client.pending[id] = ch
+	client.pendingMu.Unlock()
+
+	rawID := json.RawMessage(fmt.Sprintf("%d", id))
+	if err := client.send(rpcMessage{JSONRPC: "2.0", ID: &rawID, Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-client.closed:
+		return fmt.Errorf("mcp server %s closed the connection", client.Name)
+	case <-time.After(requestTimeout):
+		client.pendingMu.Lock()
+		delete(client.pending, id)
+		client.pendingMu.Unlock()
+		return fmt.Errorf("mcp server %s: %s timed out", client.Name, method)
+	}
+}
+
+func (client *Client) Initialize() error {
+	params := map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "cir", "version": "0.1.0"},
+	}
+	if err := client.call("initialize", params, nil); err != nil {
+		return err
+	}
+	return client.send(rpcMessage{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+func (client *Client) Close() error {
+	err := client.writer.Close()
+	if client.cmd != nil {
+		done := make(chan struct{})
+		go func() {
+			client.cmd.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			client.cmd.Process.Kill()
+		}
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The test binary doubles as a stub MCP server when this variable is set
+const stubServerEnv = "CIR_MCP_STUB_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(stubServerEnv) == "1" {
+		runStubServer()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func runStubServer() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req struct {
+			ID     *json.RawMessage `json:"id"`
+			Method string           `json:"method"`
+			Params struct {
+				Name      string            `json:"name"`
+				Arguments map[string]string `json:"arguments"`
+				URI       string            `json:"uri"`
+				Cursor    string            `json:"cursor"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == nil {
+			continue
+		}
+		var result interface{}
+		switch req.Method {
+		case "initialize":
+			result = map[string]interface{}{"protocolVersion": ProtocolVersion, "capabilities": map[string]interface{}{}}
+		case "tools/list":
+			// Two pages to exercise pagination
+			if req.Params.Cursor == "" {
+				result = map[string]interface{}{"tools": []Tool{{Name: "echo", Description: "Echo the text"}}, "nextCursor": "2"}
+			} else {
+				result = map[string]interface{}{"tools": []Tool{{Name: "fail"}}}
+			}
+		case "tools/call":
+			if req.Params.Name == "fail" {
+				result = map[string]interface{}{"content": []Content{{Type: "text", Text: "it failed"}}, "isError": true}
+			} else {
+				result = map[string]interface{}{"content": []Content{{Type: "text", Text: "echo: " + req.Params.Arguments["text"]}}}
+			}
+		case "resources/list":
+			result = map[string]interface{}{"resources": []Resource{{URI: "stub://readme", Name: "readme"}}}
+		case "resources/read":
+			result = map[string]interface{}{"contents": []ResourceContents{{URI: req.Params.URI, Text: "contents of " + req.Params.URI}}}
+		case "prompts/list":
+			result = map[string]interface{}{"prompts": []Prompt{{Name: "review"}}}
+		case "prompts/get":
+			result = map[string]interface{}{"messages": []PromptMessage{{Role: "user", Content: Content{Type: "text", Text: "Please review"}}}}
+		default:
+			fmt.Printf(`{"jsonrpc":"2.0","id":%s,"error":{"code":-32601,"message":"method not found"}}`+"\n", *req.ID)
+			continue
+		}
+		data, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+		fmt.Println(string(data))
+	}
+}
+
+func startStub(t *testing.T) *Client {
+	client, err := Start("stub", os.Args[0], nil, map[string]string{stubServerEnv: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestListAndCallTools(t *testing.T) {
+	client := startStub(t)
+
+	tools, err := client.ListTools()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"echo", "fail"}, []string{tools[0].Name, tools[1].Name})
+
+	result, err := client.CallTool("echo", json.RawMessage(`{"text": "hi"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "echo: hi", result)
+
+	_, err = client.CallTool("fail", json.RawMessage(`{}`))
+	assert.EqualError(t, err, "it failed")
+}
+
+func TestResourcesAndPrompts(t *testing.T) {
+	client := startStub(t)
+
+	resources, err := client.ListResources()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(resources))
+
+	contents, err := client.ReadResource(resources[0].URI)
+	assert.NoError(t, err)
+	assert.Equal(t, "contents of stub://readme", contents)
+
+	prompts, err := client.ListPrompts()
+	assert.NoError(t, err)
+	assert.Equal(t, "review", prompts[0].Name)
+
+	text, err := client.GetPrompt("review", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "Please review", text)
+}
+
+func TestUnknownMethod(t *testing.T) {
+	client := startStub(t)
+	err := client.call("unknown/method", nil, nil)
+	assert.EqualError(t, err, "mcp error -32601: method not found")
+}
@@ -0,0 +1,157 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MimeType    string `json:"mimeType"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Arguments   []PromptArgument `json:"arguments"`
+}
+
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Blob     string `json:"blob"`
+}
+
+type PromptMessage struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// list calls a paginated list method and collects all pages of the given field
+func list[T any](client *Client, method string, field string) ([]T, error) {
+	items := []T{}
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page map[string]json.RawMessage
+		if err := client.call(method, params, &page); err != nil {
+			return nil, err
+		}
+		var pageItems []T
+		if raw, ok := page[field]; ok {
+			if err := json.Unmarshal(raw, &pageItems); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, pageItems...)
+
+		cursor = ""
+		if raw, ok := page["nextCursor"]; ok {
+			json.Unmarshal(raw, &cursor)
+		}
+		if cursor == "" {
+			return items, nil
+		}
+	}
+}
+
+func (client *Client) ListTools() ([]Tool, error) {
+	return list[Tool](client, "tools/list", "tools")
+}
+
+func (client *Client) ListResources() ([]Resource, error) {
+	return list[Resource](client, "resources/list", "resources")
+}
+
+func (client *Client) ListPrompts() ([]Prompt, error) {
+	return list[Prompt](client, "prompts/list", "prompts")
+}
+
+// CallTool calls a tool and returns its text content
+func (client *Client) CallTool(name string, arguments json.RawMessage) (string, error) {
+	var result struct {
+		Content []Content `json:"content"`
+		IsError bool      `json:"isError"`
+	}
+	params := map[string]interface{}{"name": name, "arguments": arguments}
+	if err := client.call("tools/call", params, &result); err != nil {
+		return "", err
+	}
+	text := joinContent(result.Content)
+	if result.IsError {
+		return "", fmt.Errorf("%s", text)
+	}
+	return text, nil
+}
+
+// ReadResource returns the text contents of a resource. Binary contents are left out.
+func (client *Client) ReadResource(uri string) (string, error) {
+	var result struct {
+		Contents []ResourceContents `json:"contents"`
+	}
+	if err := client.call("resources/read", map[string]interface{}{"uri": uri}, &result); err != nil {
+		return "", err
+	}
+	texts := []string{}
+	for _, c := range result.Contents {
+		if c.Blob != "" {
+			texts = append(texts, fmt.Sprintf("[binary content: %s]", c.MimeType))
+			continue
+		}
+		texts = append(texts, c.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// GetPrompt renders a prompt and returns the text of its messages
+func (client *Client) GetPrompt(name string, arguments map[string]string) (string, error) {
+	var result struct {
+		Messages []PromptMessage `json:"messages"`
+	}
+	params := map[string]interface{}{"name": name, "arguments": arguments}
+	if err := client.call("prompts/get", params, &result); err != nil {
+		return "", err
+	}
+	contents := []Content{}
+	for _, m := range result.Messages {
+		contents = append(contents, m.Content)
+	}
+	return joinContent(contents), nil
+}
+
+func joinContent(contents []Content) string {
+	texts := []string{}
+	for _, c := range contents {
+		if c.Type == "text" {
+			texts = append(texts, c.Text)
+		} else {
+			texts = append(texts, fmt.Sprintf("[%s content]", c.Type))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
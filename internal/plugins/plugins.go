@@ -0,0 +1,142 @@
+// Package plugins runs user defined commands bound to keys, in the spirit of k9s plugins
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Scopes decide what data the plugin receives
+const (
+	ScopeInput      = "input"
+	ScopeMessage    = "message"
+	ScopeWorkingSet = "working_set"
+)
+
+// Outputs decide what happens with what the plugin prints
+const (
+	OutputInput   = "input"
+	OutputContext = "context"
+	OutputModal   = "modal"
+)
+
+const timeout = 2 * time.Minute
+
+type Plugin struct {
+	ShortCut    string   `yaml:"shortCut"`
+	Description string   `yaml:"description,omitempty"`
+	Scope       string   `yaml:"scope"`
+	Command     string   `yaml:"command"`
+	Args        []string `yaml:"args,omitempty"`
+	// Pipe the scope data to stdin, it is always available as env vars too
+	Stdin  bool   `yaml:"stdin,omitempty"`
+	Output string `yaml:"output"`
+}
+
+// Data is what a plugin gets to see
+type Data struct {
+	SessionFile  string
+	Input        string
+	Message      string
+	MessageRole  string
+	WorkingFiles []string
+}
+
+type Key struct {
+	Key       tcell.Key
+	Rune      rune
+	Modifiers tcell.ModMask
+}
+
+func (key Key) Matches(event *tcell.EventKey) bool {
+	if key.Key == tcell.KeyRune {
+		return event.Key() == tcell.KeyRune && event.Rune() == key.Rune && event.Modifiers() == key.Modifiers
+	}
+	return event.Key() == key.Key
+}
+
+// ParseShortCut parses k9s style short cuts like Ctrl-E, Alt-X or F5
+func ParseShortCut(shortCut string) (Key, error) {
+	parts := strings.SplitN(shortCut, "-", 2)
+	if len(parts) == 2 && len(parts[1]) == 1 {
+		r := []rune(strings.ToUpper(parts[1]))[0]
+		switch strings.ToLower(parts[0]) {
+		case "ctrl":
+			if r >= 'A' && r <= 'Z' {
+				return Key{Key: tcell.KeyCtrlA + tcell.Key(r-'A')}, nil
+			}
+		case "alt":
+			return Key{Key: tcell.KeyRune, Rune: []rune(strings.ToLower(parts[1]))[0], Modifiers: tcell.ModAlt}, nil
+		}
+	}
+	for k, name := range tcell.KeyNames {
+		if k >= tcell.KeyF1 && k <= tcell.KeyF12 && strings.EqualFold(name, shortCut) {
+			return Key{Key: k}, nil
+		}
+	}
+	return Key{}, fmt.Errorf("unsupported short cut %q, use Ctrl-<letter>, Alt-<letter> or F1-F12", shortCut)
+}
+
+func (plugin Plugin) Validate() error {
+	if _, err := ParseShortCut(plugin.ShortCut); err != nil {
+		return err
+	}
+	switch plugin.Scope {
+	case ScopeInput, ScopeMessage, ScopeWorkingSet:
+	default:
+		return fmt.Errorf("unknown scope %q", plugin.Scope)
+	}
+	switch plugin.Output {
+	case OutputInput, OutputContext, OutputModal:
+	default:
+		return fmt.Errorf("unknown output %q", plugin.Output)
+	}
+	if plugin.Command == "" {
+		return fmt.Errorf("command is required")
+	}
+	return nil
+}
+
+func (plugin Plugin) stdinData(data Data) string {
+	switch plugin.Scope {
+	case ScopeInput:
+		return data.Input
+	case ScopeMessage:
+		return data.Message
+	case ScopeWorkingSet:
+		return strings.Join(data.WorkingFiles, "\n")
+	}
+	return ""
+}
+
+// Run runs the plugin command and returns its stdout
+func (plugin Plugin) Run(data Data) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, plugin.Command, plugin.Args...)
+	cmd.Env = append(os.Environ(),
+		"CIR_SESSION_FILE="+data.SessionFile,
+		"CIR_SCOPE="+plugin.Scope,
+		"CIR_INPUT="+data.Input,
+		"CIR_MESSAGE="+data.Message,
+		"CIR_MESSAGE_ROLE="+data.MessageRole,
+		"CIR_WORKING_FILES="+strings.Join(data.WorkingFiles, "\n"),
+	)
+	if plugin.Stdin {
+		cmd.Stdin = strings.NewReader(plugin.stdinData(data))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,47 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseShortCut(t *testing.T) {
+	key, err := ParseShortCut("Ctrl-E")
+	assert.NoError(t, err)
+	assert.True(t, key.Matches(tcell.NewEventKey(tcell.KeyCtrlE, 0, tcell.ModCtrl)))
+	assert.False(t, key.Matches(tcell.NewEventKey(tcell.KeyCtrlF, 0, tcell.ModCtrl)))
+
+	key, err = ParseShortCut("Alt-x")
+	assert.NoError(t, err)
+	assert.True(t, key.Matches(tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModAlt)))
+	assert.False(t, key.Matches(tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModNone)))
+
+	key, err = ParseShortCut("F5")
+	assert.NoError(t, err)
+	assert.True(t, key.Matches(tcell.NewEventKey(tcell.KeyF5, 0, tcell.ModNone)))
+
+	_, err = ParseShortCut("Hyper-Q")
+	assert.Error(t, err)
+}
+
+func TestRunPassesDataAsEnvAndStdin(t *testing.T) {
+	data := Data{Input: "the input", Message: "the message", WorkingFiles: []string{"a.go", "b.go"}}
+
+	envPlugin := Plugin{Scope: ScopeWorkingSet, Command: "bash", Args: []string{"-c", `printf "%s" "$CIR_WORKING_FILES"`}}
+	out, err := envPlugin.Run(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "a.go\nb.go", out)
+
+	stdinPlugin := Plugin{Scope: ScopeMessage, Command: "tr", Args: []string{"a-z", "A-Z"}, Stdin: true}
+	out, err = stdinPlugin.Run(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "THE MESSAGE", out)
+}
+
+func TestRunReportsStderr(t *testing.T) {
+	plugin := Plugin{Scope: ScopeInput, Command: "bash", Args: []string{"-c", "echo broken >&2; exit 1"}}
+	_, err := plugin.Run(Data{})
+	assert.ErrorContains(t, err, "broken")
+}
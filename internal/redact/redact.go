@@ -0,0 +1,166 @@
+// Package redact masks secrets in text before it leaves the machine
+package redact
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Names of the built-in detectors
+const (
+	PrivateKey  = "private_key"
+	APIKey      = "api_key"
+	JWT         = "jwt"
+	HighEntropy = "high_entropy"
+)
+
+type Pattern struct {
+	Name  string `yaml:"name"`
+	Regex string `yaml:"regex"`
+}
+
+type Config struct {
+	Disabled         bool      `yaml:"disabled,omitempty"`
+	DisableDetectors []string  `yaml:"disable_detectors,omitempty"`
+	Patterns         []Pattern `yaml:"patterns,omitempty"`
+	// Glob patterns of files that are sent as is
+	AllowFiles []string `yaml:"allow_files,omitempty"`
+}
+
+type detector struct {
+	kind string
+	re   *regexp.Regexp
+	// Optional extra check on a match
+	matches func(s string) bool
+}
+
+var builtinDetectors = []detector{
+	{kind: PrivateKey, re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{kind: APIKey, re: regexp.MustCompile(
+		`\bsk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}` + // OpenAI, Anthropic
+			`|\b(?:AKIA|ASIA)[0-9A-Z]{16}\b` + // AWS access key id
+			`|\bgh[pousr]_[A-Za-z0-9]{36,}\b` + // GitHub
+			`|\bgithub_pat_[A-Za-z0-9_]{22,}\b` +
+			`|\bxox[abprs]-[A-Za-z0-9-]{10,}` + // Slack
+			`|\bAIza[0-9A-Za-z_-]{35}\b` + // Google
+			`|\b[rs]k_live_[0-9a-zA-Z]{24,}\b`, // Stripe
+	)},
+	{kind: JWT, re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	{kind: HighEntropy, re: regexp.MustCompile(`[A-Za-z0-9+/_-]{20,}={0,2}`), matches: isHighEntropy},
+}
+
+type Redactor struct {
+	detectors  []detector
+	allowFiles []string
+}
+
+// Finding counts what was masked in one source, the question or a file
+type Finding struct {
+	Source string
+	Kinds  map[string]int
+}
+
+func (f Finding) String() string {
+	kinds := []string{}
+	for kind, count := range f.Kinds {
+		kinds = append(kinds, fmt.Sprintf("%s (%d)", kind, count))
+	}
+	sort.Strings(kinds)
+	return fmt.Sprintf("%s: %s", f.Source, strings.Join(kinds, ", "))
+}
+
+// New returns nil if redaction is disabled. A nil Redactor redacts nothing.
+func New(config Config) (*Redactor, error) {
+	if config.Disabled {
+		return nil, nil
+	}
+	redactor := &Redactor{allowFiles: config.AllowFiles}
+	for _, d := range builtinDetectors {
+		if !contains(config.DisableDetectors, d.kind) {
+			redactor.detectors = append(redactor.detectors, d)
+		}
+	}
+	// User patterns go before the entropy check so they get their own name
+	userDetectors := []detector{}
+	for _, p := range config.Patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("redaction pattern %s: %w", p.Name, err)
+		}
+		userDetectors = append(userDetectors, detector{kind: p.Name, re: re})
+	}
+	n := len(redactor.detectors)
+	if n > 0 && redactor.detectors[n-1].kind == HighEntropy {
+		userDetectors = append(userDetectors, redactor.detectors[n-1])
+		redactor.detectors = redactor.detectors[:n-1]
+	}
+	redactor.detectors = append(redactor.detectors, userDetectors...)
+	return redactor, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed tells whether a file is exempt from redaction
+func (redactor *Redactor) Allowed(path string) bool {
+	if redactor == nil {
+		return true
+	}
+	cleaned := filepath.Clean(path)
+	for _, pattern := range redactor.allowFiles {
+		for _, p := range []string{path, cleaned, filepath.Base(cleaned)} {
+			if ok, _ := filepath.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Redact masks secrets in text and counts what was masked per kind
+func (redactor *Redactor) Redact(text string) (string, map[string]int) {
+	found := map[string]int{}
+	if redactor == nil {
+		return text, found
+	}
+	for _, d := range redactor.detectors {
+		text = d.re.ReplaceAllStringFunc(text, func(match string) string {
+			if d.matches != nil && !d.matches(match) {
+				return match
+			}
+			found[d.kind]++
+			return "[REDACTED:" + d.kind + "]"
+		})
+	}
+	return text, found
+}
+
+func shannonEntropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+	entropy := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// Random looking tokens with both letters and digits, identifiers are usually neither
+func isHighEntropy(s string) bool {
+	hasDigit := strings.ContainsAny(s, "0123456789")
+	hasLetter := strings.IndexFunc(s, func(r rune) bool { return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') }) >= 0
+	return hasDigit && hasLetter && shannonEntropy(s) >= 4.5
+}
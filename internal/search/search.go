@@ -0,0 +1,222 @@
+// Package search finds messages across all session files
+package search
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+const snippetContext = 40
+
+// A searchable message. Tool results are left out.
+type Document struct {
+	MessageID int      `json:"message_id"`
+	Role      string   `json:"role"`
+	Text      string   `json:"text"`
+	Files     []string `json:"files,omitempty"`
+}
+
+type Result struct {
+	SessionFile string
+	MessageID   int
+	Role        string
+	Snippet     string
+	ModTime     time.Time
+}
+
+type entry struct {
+	ModTime   time.Time  `json:"mod_time"`
+	Size      int64      `json:"size"`
+	Documents []Document `json:"documents"`
+}
+
+// Index keeps the documents of each session file until the file changes. With a
+// path it is kept on disk between runs, otherwise it only lives in memory.
+type Index struct {
+	path     string
+	Sessions map[string]*entry `json:"sessions"`
+}
+
+// Open reads the index at path. A missing or unreadable index starts out empty, it
+// is rebuilt by Refresh anyway. An empty path gives an in-memory index.
+func Open(path string) *Index {
+	index := &Index{path: path, Sessions: map[string]*entry{}}
+	if path == "" {
+		return index
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, index); err != nil || index.Sessions == nil {
+		index.Sessions = map[string]*entry{}
+	}
+	return index
+}
+
+// Documents lists the searchable messages of every branch in a session
+func Documents(workingSession *types.WorkingSession) []Document {
+	workingSession.Sync()
+	documents := []Document{}
+	for _, msg := range workingSession.Tree {
+		if doc, ok := DocumentOf(msg); ok {
+			documents = append(documents, doc)
+		}
+	}
+	return documents
+}
+
+// DocumentOf gives the searchable part of a message, false if there is none
+func DocumentOf(msg types.Message) (Document, bool) {
+	doc := Document{MessageID: msg.ID, Role: msg.Role}
+	switch {
+	case msg.Role == types.RoleTool:
+		return doc, false
+	case msg.Role == types.RoleUser:
+		doc.Text = msg.Question
+		for _, wf := range msg.IncludedWorkingFiles {
+			doc.Files = append(doc.Files, wf.Path)
+		}
+	default:
+		doc.Text = msg.Content
+	}
+	return doc, doc.Text != "" || len(doc.Files) > 0
+}
+
+// SearchText is the lower cased text that the terms of a query are looked for in
+func (doc Document) SearchText() string {
+	return strings.ToLower(doc.Text + "\n" + strings.Join(doc.Files, "\n"))
+}
+
+// Terms splits a query into the lower cased words that all have to match
+func Terms(query string) []string {
+	return strings.Fields(strings.ToLower(query))
+}
+
+// Refresh re-reads the session files that changed since they were indexed and
+// forgets the ones that are gone. Files that aren't sessions are indexed as empty.
+func (index *Index) Refresh(sessionFiles []string) error {
+	seen := map[string]bool{}
+	for _, sessionFile := range sessionFiles {
+		seen[sessionFile] = true
+		stat, err := os.Stat(sessionFile)
+		if err != nil {
+			continue
+		}
+		if e, ok := index.Sessions[sessionFile]; ok && e.ModTime.Equal(stat.ModTime()) && e.Size == stat.Size() {
+			continue
+		}
+		e := &entry{ModTime: stat.ModTime(), Size: stat.Size(), Documents: []Document{}}
+		data, err := os.ReadFile(sessionFile)
+		if err != nil {
+			return err
+		}
+		if workingSession, err := types.UnmarshalWorkingSession(data); err == nil {
+			e.Documents = Documents(workingSession)
+		}
+		index.Sessions[sessionFile] = e
+	}
+	for sessionFile := range index.Sessions {
+		if !seen[sessionFile] {
+			delete(index.Sessions, sessionFile)
+		}
+	}
+	return index.Save()
+}
+
+// Save writes the index to disk, if it has a path
+func (index *Index) Save() error {
+	if index.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	tmp := index.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, index.path)
+}
+
+// Search finds the messages that contain every word of the query, ignoring case.
+// Results from the most recently modified sessions come first. A limit of 0 means
+// no limit.
+func (index *Index) Search(query string, limit int) []Result {
+	terms := Terms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	results := []Result{}
+	for sessionFile, e := range index.Sessions {
+		for _, doc := range e.Documents {
+			text := doc.SearchText()
+			matches := true
+			for _, term := range terms {
+				if !strings.Contains(text, term) {
+					matches = false
+					break
+				}
+			}
+			if !matches {
+				continue
+			}
+			results = append(results, Result{
+				SessionFile: sessionFile,
+				MessageID:   doc.MessageID,
+				Role:        doc.Role,
+				Snippet:     Snippet(doc, terms[0]),
+				ModTime:     e.ModTime,
+			})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if !results[i].ModTime.Equal(results[j].ModTime) {
+			return results[i].ModTime.After(results[j].ModTime)
+		}
+		if results[i].SessionFile != results[j].SessionFile {
+			return results[i].SessionFile < results[j].SessionFile
+		}
+		return results[i].MessageID < results[j].MessageID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// Snippet is the text around the first match of term, on one line
+func Snippet(doc Document, term string) string {
+	text := doc.Text
+	idx := strings.Index(strings.ToLower(text), term)
+	if idx < 0 {
+		// The term is in a file path
+		text = strings.Join(doc.Files, ", ")
+		idx = strings.Index(strings.ToLower(text), term)
+	}
+	// Lower casing can change the length of non-ASCII text, so stay within it
+	start := min(max(idx-snippetContext, 0), len(text))
+	end := min(idx+len(term)+snippetContext, len(text))
+	// Don't cut runes in half
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	s := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		s = "..." + s
+	}
+	if end < len(text) {
+		s += "..."
+	}
+	return s
+}
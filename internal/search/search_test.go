@@ -0,0 +1,90 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/worldsayshi/cir/internal/types"
+	"gopkg.in/yaml.v2"
+)
+
+func writeSession(t *testing.T, path string, messages ...types.Message) {
+	workingSession := &types.WorkingSession{Messages: messages}
+	workingSession.Sync()
+	apiVersion := types.CurrentApiVersion
+	workingSession.ApiVersion = &apiVersion
+	data, err := yaml.Marshal(workingSession)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+}
+
+func question(q string, files ...string) types.Message {
+	msg := types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser, Content: "<question>" + q + "</question>"}, Question: q}
+	for _, f := range files {
+		msg.IncludedWorkingFiles = append(msg.IncludedWorkingFiles, types.WorkingFile{Path: f})
+	}
+	return msg
+}
+
+func answer(a string) types.Message {
+	return types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem, Content: a}}
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.yaml")
+	second := filepath.Join(dir, "second.yaml")
+	writeSession(t, first, question("How do I rotate the logs?", "logrotate.conf"), answer("Use logrotate with a daily schedule."))
+	writeSession(t, second, question("What is a goroutine?"), answer("A lightweight thread managed by the Go runtime."))
+
+	index := Open("")
+	assert.NoError(t, index.Refresh([]string{first, second}))
+
+	results := index.Search("LOGROTATE daily", 0)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, first, results[0].SessionFile)
+	assert.Equal(t, 2, results[0].MessageID)
+	assert.Equal(t, "Use logrotate with a daily schedule.", results[0].Snippet)
+
+	// Attached file paths are searched too
+	results = index.Search("logrotate.conf", 0)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, types.RoleUser, results[0].Role)
+
+	assert.Empty(t, index.Search("  ", 0))
+	assert.Empty(t, index.Search("kubernetes", 0))
+}
+
+func TestPersistentIndex(t *testing.T) {
+	dir := t.TempDir()
+	session := filepath.Join(dir, "session.yaml")
+	indexFile := filepath.Join(dir, "index.json")
+	writeSession(t, session, question("Where is the config?"), answer("In ~/.cir/config.yaml"))
+
+	index := Open(indexFile)
+	assert.NoError(t, index.Refresh([]string{session}))
+	assert.Equal(t, 1, len(index.Search("config", 1)))
+
+	// A reopened index knows the session without reading it again
+	reopened := Open(indexFile)
+	assert.Equal(t, 2, len(reopened.Search("config", 0)))
+
+	// Changed sessions are read again, removed ones are forgotten
+	writeSession(t, session, question("Something else entirely"))
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(session, later, later))
+	assert.NoError(t, reopened.Refresh([]string{session}))
+	assert.Empty(t, reopened.Search("config", 0))
+	assert.NoError(t, reopened.Refresh(nil))
+	assert.Empty(t, Open(indexFile).Search("something", 0))
+}
+
+func TestSnippet(t *testing.T) {
+	doc := Document{Text: "The quick brown fox jumps over the lazy dog. It keeps running far away from the hunter in the woods."}
+	s := Snippet(doc, "lazy")
+	assert.Contains(t, s, "lazy dog")
+	assert.True(t, len(s) < len(doc.Text))
+}
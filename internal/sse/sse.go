@@ -0,0 +1,124 @@
+// Package sse reads server-sent event streams as specified in
+// https://html.spec.whatwg.org/multipage/server-sent-events.html
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lines are cut at this length, long enough for any chunk a model streams
+const maxLineLength = 16 * 1024 * 1024
+
+type Event struct {
+	// "message" unless the event said otherwise
+	Type string
+	// The data lines of the event joined by newlines
+	Data string
+	// The last event ID seen in the stream, it carries over to later events
+	ID string
+	// The reconnection time the server asked for, zero if it didn't
+	Retry time.Duration
+}
+
+type Reader struct {
+	scanner *bufio.Scanner
+	lastID  string
+	retry   time.Duration
+	first   bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	scanner.Split(scanLines)
+	return &Reader{scanner: scanner, first: true}
+}
+
+// Next returns the next event. At the end of the stream it returns io.EOF, an event
+// that isn't terminated by a blank line is dropped.
+func (r *Reader) Next() (Event, error) {
+	eventType := ""
+	var data strings.Builder
+	hasData := false
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if r.first {
+			line = strings.TrimPrefix(line, "\uFEFF")
+			r.first = false
+		}
+
+		if line == "" {
+			if !hasData {
+				// Nothing to dispatch, start over
+				eventType = ""
+				continue
+			}
+			event := Event{Type: "message", Data: strings.TrimSuffix(data.String(), "\n"), ID: r.lastID, Retry: r.retry}
+			if eventType != "" {
+				event.Type = eventType
+			}
+			return event, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			// A comment, often sent to keep the connection alive
+			continue
+		}
+
+		field, value, found := strings.Cut(line, ":")
+		if found {
+			value = strings.TrimPrefix(value, " ")
+		}
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				r.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				r.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+// scanLines splits on CRLF, LF or CR
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// A CR may be followed by an LF that isn't read yet
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
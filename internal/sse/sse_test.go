@@ -0,0 +1,87 @@
+package sse
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(t *testing.T, stream string) []Event {
+	reader := NewReader(strings.NewReader(stream))
+	events := []Event{}
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return events
+		}
+		assert.NoError(t, err)
+		events = append(events, event)
+	}
+}
+
+func TestRecordedStreams(t *testing.T) {
+	cases := map[string]int{
+		"testdata/openai-text.sse":       6,
+		"testdata/openai-tool-calls.sse": 5,
+	}
+	for file, count := range cases {
+		data, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		events := readAll(t, string(data))
+		assert.Len(t, events, count, file)
+		for _, event := range events[:len(events)-1] {
+			assert.Equal(t, "message", event.Type)
+			assert.True(t, json.Valid([]byte(event.Data)), "invalid JSON in %s: %s", file, event.Data)
+		}
+		assert.Equal(t, "[DONE]", events[len(events)-1].Data)
+	}
+}
+
+func TestEventFraming(t *testing.T) {
+	stream := "\uFEFF: a comment\n" +
+		"event: update\n" +
+		"id: 1\n" +
+		"data: first line\n" +
+		"data:second line\n" +
+		"data:  indented\n" +
+		"\n" +
+		// No data, nothing is dispatched
+		"event: ignored\n\n" +
+		"retry: 1500\n" +
+		"data\n" +
+		"unknown: field\n" +
+		"\n" +
+		// Cut off before the blank line
+		"data: incomplete\n"
+	events := readAll(t, stream)
+	assert.Equal(t, []Event{
+		{Type: "update", Data: "first line\nsecond line\n indented", ID: "1"},
+		{Type: "message", Data: "", ID: "1", Retry: 1500 * time.Millisecond},
+	}, events)
+}
+
+func TestLineEndings(t *testing.T) {
+	for _, newline := range []string{"\n", "\r\n", "\r"} {
+		stream := strings.ReplaceAll("data: a\n\ndata: b\ndata: c\n\n", "\n", newline)
+		events := readAll(t, stream)
+		assert.Len(t, events, 2, "newline %q", newline)
+		if len(events) == 2 {
+			assert.Equal(t, "a", events[0].Data)
+			assert.Equal(t, "b\nc", events[1].Data)
+		}
+	}
+}
+
+// A CR at the end of a read must not be taken as a line of its own when the LF
+// comes in the next read
+func TestSplitCRLF(t *testing.T) {
+	reader := NewReader(io.MultiReader(strings.NewReader("data: a\r"), strings.NewReader("\ndata: b\r\n\r\n")))
+	event, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb", event.Data)
+}
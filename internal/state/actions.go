@@ -0,0 +1,262 @@
+package state
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Loaded replaces the session, after it was read again or another one was opened
+type Loaded struct {
+	Session *types.WorkingSession
+}
+
+func (a Loaded) reduce(state *State) Slice {
+	state.Session = a.Session
+	state.Answer = -1
+	return All
+}
+
+// InputChanged is the text being written, as it is typed
+type InputChanged struct {
+	Text string
+}
+
+func (a InputChanged) reduce(state *State) Slice {
+	state.Session.InputText = a.Text
+	return Input
+}
+
+// Submit adds a question to the current branch and clears the input. The context
+// files sent with it are marked as submitted, so they are only sent again if they
+// change.
+type Submit struct {
+	Message types.Message
+}
+
+func (a Submit) reduce(state *State) Slice {
+	ws := state.Session
+	ws.Messages = append(ws.Messages, a.Message)
+	for i, wf := range ws.WorkingFiles {
+		for _, submitted := range a.Message.IncludedWorkingFiles {
+			if wf.Path == submitted.Path {
+				ws.WorkingFiles[i] = submitted
+			}
+		}
+	}
+	ws.InputText = ""
+	return Messages | Context | Input
+}
+
+// ContextChanged replaces the working files
+type ContextChanged struct {
+	WorkingFiles []types.WorkingFile
+}
+
+func (a ContextChanged) reduce(state *State) Slice {
+	state.Session.WorkingFiles = a.WorkingFiles
+	return Context
+}
+
+// StreamRequested marks an answer as coming before its message is added, or for
+// answers that are streamed elsewhere like those of a comparison. Nothing else may
+// change the session until StreamDone.
+type StreamRequested struct{}
+
+func (a StreamRequested) reduce(state *State) Slice {
+	state.Streaming = true
+	return Stream
+}
+
+// StreamStarted adds the message that an answer is streamed into
+type StreamStarted struct {
+	Answer types.Message
+}
+
+func (a StreamStarted) reduce(state *State) Slice {
+	ws := state.Session
+	ws.Messages = append(ws.Messages, a.Answer)
+	state.Answer = len(ws.Messages) - 1
+	state.Streaming = true
+	return Messages | Stream
+}
+
+// ChunkReceived adds a streamed chunk to the answer
+type ChunkReceived struct {
+	Chunk string
+	Time  time.Time
+}
+
+func (a ChunkReceived) reduce(state *State) Slice {
+	answer := state.answer()
+	if answer == nil {
+		return 0
+	}
+	if answer.TimeToFirstToken == 0 && answer.Time != nil {
+		answer.TimeToFirstToken = a.Time.Sub(*answer.Time)
+	}
+	answer.Content += a.Chunk
+	return Messages
+}
+
+// ToolCallsReceived ends a streamed answer with the tools the model wants to call.
+// The answer becomes the assistant message with the calls, and the stream goes on
+// once the results are in.
+type ToolCallsReceived struct {
+	ToolCalls []types.ToolCall
+	Usage     *types.Usage
+	Time      time.Time
+}
+
+func (a ToolCallsReceived) reduce(state *State) Slice {
+	answer := state.answer()
+	if answer == nil {
+		return 0
+	}
+	finish(answer, a.Time, a.Usage)
+	answer.AiServiceMessage = types.AiServiceMessage{
+		Role:      types.RoleAssistant,
+		Content:   answer.Content,
+		ToolCalls: a.ToolCalls,
+	}
+	state.Answer = -1
+	return Messages
+}
+
+// ToolResult adds the result of a tool call
+type ToolResult struct {
+	Message types.Message
+}
+
+func (a ToolResult) reduce(state *State) Slice {
+	state.Session.Messages = append(state.Session.Messages, a.Message)
+	return Messages
+}
+
+// StreamDone ends the stream. With an error, the error replaces the answer.
+type StreamDone struct {
+	Usage *types.Usage
+	Err   error
+	Time  time.Time
+}
+
+func (a StreamDone) reduce(state *State) Slice {
+	if answer := state.answer(); answer != nil {
+		finish(answer, a.Time, a.Usage)
+		if a.Err != nil {
+			answer.Content = fmt.Sprintf("Error: %v", a.Err)
+		}
+	}
+	state.Answer = -1
+	state.Streaming = false
+	return Messages | Stream
+}
+
+// AnswerRewritten replaces the content of an answer, like post-response hooks do
+type AnswerRewritten struct {
+	Index   int
+	Content string
+}
+
+func (a AnswerRewritten) reduce(state *State) Slice {
+	state.Session.Messages[a.Index].Content = a.Content
+	return Messages
+}
+
+// Forked cuts the current branch before the message at Index, to continue it from
+// there. The messages after the cut stay in the tree as the old branch.
+type Forked struct {
+	Index int
+}
+
+func (a Forked) reduce(state *State) Slice {
+	state.Session.Fork(a.Index)
+	return Messages | Context
+}
+
+// CheckedOut makes the branch through a message the current one
+type CheckedOut struct {
+	MessageID int
+}
+
+func (a CheckedOut) reduce(state *State) Slice {
+	state.Session.Checkout(a.MessageID)
+	return Messages | Context
+}
+
+// Removed cuts the current branch before the message at Index, like Forked, and
+// removes the message and all that follow it from the tree
+type Removed struct {
+	Index int
+}
+
+func (a Removed) reduce(state *State) Slice {
+	ws := state.Session
+	// A message that was never saved gets its ID here
+	ws.Sync()
+	id := ws.Messages[a.Index].ID
+	ws.Fork(a.Index)
+	ws.Remove(id)
+	return Messages | Context
+}
+
+// ComparisonCommitted adds the chosen answer of a comparison to the current branch,
+// with the other answers as alternatives to it
+type ComparisonCommitted struct {
+	Chosen       types.Message
+	Alternatives []types.Message
+}
+
+func (a ComparisonCommitted) reduce(state *State) Slice {
+	ws := state.Session
+	for _, alternative := range a.Alternatives {
+		ws.Messages = append(ws.Messages, alternative)
+		ws.Fork(len(ws.Messages) - 1)
+	}
+	ws.Messages = append(ws.Messages, a.Chosen)
+	return Messages | Context
+}
+
+// AgentToggled turns agent mode on or off. Commands need approval unless the session
+// says otherwise.
+type AgentToggled struct{}
+
+func (a AgentToggled) reduce(state *State) Slice {
+	ws := state.Session
+	if ws.Agent == nil {
+		ws.Agent = &types.AgentSettings{
+			ApprovalPolicy: types.ApprovalPolicy{Mode: types.ApprovalAlwaysAsk},
+		}
+	}
+	ws.Agent.Enabled = !ws.Agent.Enabled
+	return Agent
+}
+
+// CommandLogged records what became of a command the model proposed. The log isn't
+// shown, so nothing is rendered.
+type CommandLogged struct {
+	Entry types.CommandDecision
+}
+
+func (a CommandLogged) reduce(state *State) Slice {
+	state.Session.CommandLog = append(state.Session.CommandLog, a.Entry)
+	return 0
+}
+
+func (state *State) answer() *types.Message {
+	if state.Answer < 0 || state.Answer >= len(state.Session.Messages) {
+		return nil
+	}
+	return &state.Session.Messages[state.Answer]
+}
+
+// Record how long an answer took and the tokens it used
+func finish(answer *types.Message, now time.Time, usage *types.Usage) {
+	if answer.Time != nil {
+		answer.Duration = now.Sub(*answer.Time)
+	}
+	if usage != nil {
+		answer.Usage = usage
+	}
+}
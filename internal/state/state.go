@@ -0,0 +1,76 @@
+// Package state keeps the state of a chat and changes it only through actions. A
+// handler dispatches an action to the store, the action changes the state, and the
+// subscribers to the slices of the state that changed render them. Control flows in
+// one direction, and the flow can be tested without a terminal.
+package state
+
+import (
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// A Slice is a part of the state that subscribers can follow
+type Slice int
+
+const (
+	// The messages of the current branch
+	Messages Slice = 1 << iota
+	// The working files
+	Context
+	// The text being written
+	Input
+	// Whether an answer is streaming
+	Stream
+	// Whether agent mode is on
+	Agent
+
+	All = Messages | Context | Input | Stream | Agent
+)
+
+type State struct {
+	Session *types.WorkingSession
+	// An answer is being streamed, or tools called for it
+	Streaming bool
+	// Index of the message that chunks are streamed into, -1 if there is none
+	Answer int
+}
+
+// An Action is a change to the state. It returns the slices it changed.
+type Action interface {
+	reduce(state *State) Slice
+}
+
+type subscriber struct {
+	slices Slice
+	render func(State)
+}
+
+// Store holds the state. Actions are dispatched and subscribers rendered on a single
+// goroutine, the UI goroutine in the TUI.
+type Store struct {
+	state       State
+	subscribers []subscriber
+}
+
+func NewStore(session *types.WorkingSession) *Store {
+	return &Store{state: State{Session: session, Answer: -1}}
+}
+
+func (store *Store) State() State {
+	return store.state
+}
+
+// Subscribe calls render after each action that changes any of the slices
+func (store *Store) Subscribe(slices Slice, render func(State)) {
+	store.subscribers = append(store.subscribers, subscriber{slices, render})
+}
+
+// Dispatch applies the action and renders the subscribers of what it changed.
+// Subscribers may dispatch in turn.
+func (store *Store) Dispatch(action Action) {
+	changed := action.reduce(&store.state)
+	for _, s := range store.subscribers {
+		if s.slices&changed != 0 {
+			s.render(store.state)
+		}
+	}
+}
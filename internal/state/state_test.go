@@ -0,0 +1,199 @@
+package state
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Count the renders of each slice
+func subscribeAll(store *Store) map[Slice]int {
+	renders := map[Slice]int{}
+	for _, slice := range []Slice{Messages, Context, Input, Stream, Agent} {
+		slice := slice
+		store.Subscribe(slice, func(State) { renders[slice]++ })
+	}
+	return renders
+}
+
+func TestSubmit(t *testing.T) {
+	checksum := "abc"
+	session := &types.WorkingSession{
+		InputText:    "What does main.go do?",
+		WorkingFiles: []types.WorkingFile{{Path: "main.go"}, {Path: "README.md"}},
+	}
+	store := NewStore(session)
+	renders := subscribeAll(store)
+
+	store.Dispatch(Submit{Message: types.Message{
+		AiServiceMessage:     types.AiServiceMessage{Role: types.RoleUser, Content: "..."},
+		Question:             "What does main.go do?",
+		IncludedWorkingFiles: []types.WorkingFile{{Path: "main.go", LastSubmittedChecksum: &checksum}},
+	}})
+
+	assert.Len(t, session.Messages, 1)
+	assert.Equal(t, "", session.InputText)
+	assert.Equal(t, &checksum, session.WorkingFiles[0].LastSubmittedChecksum)
+	assert.Nil(t, session.WorkingFiles[1].LastSubmittedChecksum)
+	assert.Equal(t, map[Slice]int{Messages: 1, Context: 1, Input: 1}, renders)
+}
+
+func TestStreamAnswer(t *testing.T) {
+	start := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	session := &types.WorkingSession{}
+	store := NewStore(session)
+	renders := subscribeAll(store)
+
+	store.Dispatch(StreamStarted{Answer: types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem}, Time: &start}})
+	assert.True(t, store.State().Streaming)
+	assert.Equal(t, 0, store.State().Answer)
+
+	store.Dispatch(ChunkReceived{Chunk: "Hello", Time: start.Add(time.Second)})
+	store.Dispatch(ChunkReceived{Chunk: " there", Time: start.Add(2 * time.Second)})
+	usage := &types.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}
+	store.Dispatch(StreamDone{Usage: usage, Time: start.Add(3 * time.Second)})
+
+	answer := session.Messages[0]
+	assert.Equal(t, "Hello there", answer.Content)
+	assert.Equal(t, time.Second, answer.TimeToFirstToken)
+	assert.Equal(t, 3*time.Second, answer.Duration)
+	assert.Equal(t, usage, answer.Usage)
+	assert.False(t, store.State().Streaming)
+	assert.Equal(t, -1, store.State().Answer)
+	assert.Equal(t, map[Slice]int{Messages: 4, Stream: 2}, renders)
+
+	// Chunks after the stream is done go nowhere
+	store.Dispatch(ChunkReceived{Chunk: "late"})
+	assert.Equal(t, "Hello there", session.Messages[0].Content)
+}
+
+func TestToolCalls(t *testing.T) {
+	session := &types.WorkingSession{}
+	store := NewStore(session)
+
+	store.Dispatch(StreamStarted{Answer: types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem}}})
+	call := types.ToolCall{ID: "call_1", Type: "function"}
+	store.Dispatch(ToolCallsReceived{ToolCalls: []types.ToolCall{call}})
+	store.Dispatch(ToolResult{Message: types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleTool, Content: "package main", ToolCallID: "call_1"}}})
+	assert.True(t, store.State().Streaming, "Expected the answer to go on after the tool calls")
+
+	store.Dispatch(StreamStarted{Answer: types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem}}})
+	store.Dispatch(ChunkReceived{Chunk: "It's the main package"})
+	store.Dispatch(StreamDone{})
+
+	assert.Len(t, session.Messages, 3)
+	assert.Equal(t, types.RoleAssistant, session.Messages[0].Role)
+	assert.Equal(t, []types.ToolCall{call}, session.Messages[0].ToolCalls)
+	assert.Equal(t, "It's the main package", session.Messages[2].Content)
+	assert.False(t, store.State().Streaming)
+}
+
+func TestStreamError(t *testing.T) {
+	session := &types.WorkingSession{}
+	store := NewStore(session)
+	store.Dispatch(StreamStarted{Answer: types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem}}})
+	store.Dispatch(ChunkReceived{Chunk: "Partial"})
+	store.Dispatch(StreamDone{Err: errors.New("connection reset")})
+	assert.Equal(t, "Error: connection reset", session.Messages[0].Content)
+}
+
+func TestLoaded(t *testing.T) {
+	store := NewStore(&types.WorkingSession{InputText: "old"})
+	var rendered *types.WorkingSession
+	store.Subscribe(Input, func(s State) { rendered = s.Session })
+
+	loaded := &types.WorkingSession{InputText: "new"}
+	store.Dispatch(Loaded{Session: loaded})
+	assert.Same(t, loaded, rendered)
+
+	store.Dispatch(InputChanged{Text: "typed"})
+	assert.Equal(t, "typed", loaded.InputText)
+
+	store.Dispatch(ContextChanged{WorkingFiles: []types.WorkingFile{{Path: "go.mod"}}})
+	assert.Equal(t, "go.mod", loaded.WorkingFiles[0].Path)
+}
+
+func question(q string) types.Message {
+	return types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser, Content: q}, Question: q}
+}
+
+func answer(a string) types.Message {
+	return types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem, Content: a}}
+}
+
+func TestBranches(t *testing.T) {
+	session := &types.WorkingSession{Messages: []types.Message{question("q1"), answer("a1"), question("q2"), answer("a2")}}
+	session.Sync()
+	store := NewStore(session)
+	renders := subscribeAll(store)
+
+	// Editing the second question
+	store.Dispatch(Forked{Index: 2})
+	store.Dispatch(Submit{Message: question("q2 edited")})
+	assert.Len(t, session.Messages, 3)
+	session.Sync()
+	assert.Len(t, session.Tree, 5)
+
+	store.Dispatch(CheckedOut{MessageID: 4})
+	assert.Equal(t, "a2", session.Messages[3].Content)
+
+	// Regenerating the answer without keeping it
+	store.Dispatch(Removed{Index: 3})
+	assert.Len(t, session.Messages, 3)
+	assert.Len(t, session.Tree, 4)
+	assert.Equal(t, map[Slice]int{Messages: 4, Context: 4, Input: 1}, renders)
+}
+
+func TestComparisonCommitted(t *testing.T) {
+	session := &types.WorkingSession{Messages: []types.Message{question("q1")}}
+	store := NewStore(session)
+	renders := subscribeAll(store)
+
+	store.Dispatch(StreamRequested{})
+	assert.True(t, store.State().Streaming)
+	store.Dispatch(ComparisonCommitted{Chosen: answer("b"), Alternatives: []types.Message{answer("a"), answer("c")}})
+	store.Dispatch(StreamDone{})
+
+	assert.Len(t, session.Messages, 2)
+	assert.Equal(t, "b", session.Messages[1].Content)
+	session.Sync()
+	siblings, pos := session.Siblings(1)
+	assert.Len(t, siblings, 3)
+	assert.Equal(t, 2, pos)
+	assert.False(t, store.State().Streaming)
+	assert.Equal(t, map[Slice]int{Messages: 2, Context: 1, Stream: 2}, renders)
+}
+
+func TestAgent(t *testing.T) {
+	session := &types.WorkingSession{}
+	store := NewStore(session)
+	renders := subscribeAll(store)
+
+	store.Dispatch(AgentToggled{})
+	assert.True(t, session.Agent.Enabled)
+	assert.Equal(t, types.ApprovalAlwaysAsk, session.Agent.ApprovalPolicy.Mode)
+
+	store.Dispatch(CommandLogged{Entry: types.CommandDecision{ProposedCommand: "go test ./...", Decision: types.DecisionApproved}})
+	assert.Len(t, session.CommandLog, 1)
+
+	store.Dispatch(AgentToggled{})
+	assert.False(t, session.Agent.Enabled)
+	assert.Equal(t, map[Slice]int{Agent: 2}, renders)
+}
+
+func TestRemoveUnsaved(t *testing.T) {
+	session := &types.WorkingSession{Messages: []types.Message{question("q1"), answer("a1")}}
+	session.Sync()
+	store := NewStore(session)
+	store.Dispatch(CheckedOut{MessageID: 2})
+	store.Dispatch(Forked{Index: 0})
+	store.Dispatch(Submit{Message: question("q2")})
+
+	// The new question was never saved, so it has no ID yet
+	store.Dispatch(Removed{Index: 0})
+	assert.Empty(t, session.Messages)
+	assert.Len(t, session.Tree, 2, "Expected the other branch to be kept")
+}
@@ -0,0 +1,257 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	maxReadBytes    = 100 * 1024
+	maxGrepMatches  = 200
+	maxListEntries  = 500
+	goDocTimeout    = 30 * time.Second
+	truncatedNotice = "\n[... truncated]"
+)
+
+func builtinTools() []Tool {
+	return []Tool{
+		{
+			Name:        "read_file",
+			Description: "Read a file in the project. Optionally restrict to a 1-based inclusive line range.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":       map[string]interface{}{"type": "string", "description": "Path relative to the project root"},
+					"start_line": map[string]interface{}{"type": "integer"},
+					"end_line":   map[string]interface{}{"type": "integer"},
+				},
+				"required": []string{"path"},
+			},
+			Run: readFile,
+		},
+		{
+			Name:        "list_dir",
+			Description: "List the entries of a directory in the project. Directories end with a slash.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{"type": "string", "description": "Path relative to the project root, defaults to the root"},
+				},
+			},
+			Run: listDir,
+		},
+		{
+			Name:        "grep",
+			Description: "Search files in the project for a regular expression (Go RE2 syntax). Returns path:line: text for each match.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"pattern": map[string]interface{}{"type": "string"},
+					"path":    map[string]interface{}{"type": "string", "description": "File or directory to search, defaults to the root"},
+				},
+				"required": []string{"pattern"},
+			},
+			Run: grep,
+		},
+		{
+			Name:        "go_doc",
+			Description: "Show Go documentation for a package or symbol, as printed by `go doc` in the project root.",
+			Parameters: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"package": map[string]interface{}{"type": "string", "description": "Package import path, e.g. net/http or ./internal/types"},
+					"symbol":  map[string]interface{}{"type": "string", "description": "Optional symbol, e.g. Client or Client.Do"},
+				},
+				"required": []string{"package"},
+			},
+			Run: goDoc,
+		},
+	}
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + truncatedNotice
+}
+
+func readFile(sandbox *Sandbox, rawArgs json.RawMessage) (string, error) {
+	var args struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return "", err
+	}
+	p, err := sandbox.Resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	if args.StartLine <= 0 && args.EndLine <= 0 {
+		return truncate(string(data), maxReadBytes), nil
+	}
+
+	lines := strings.Split(string(data), "\n")
+	start, end := args.StartLine, args.EndLine
+	if start <= 0 {
+		start = 1
+	}
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if start > end {
+		return "", fmt.Errorf("invalid line range %d-%d, file has %d lines", args.StartLine, args.EndLine, len(lines))
+	}
+	return truncate(strings.Join(lines[start-1:end], "\n"), maxReadBytes), nil
+}
+
+func listDir(sandbox *Sandbox, rawArgs json.RawMessage) (string, error) {
+	var args struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return "", err
+	}
+	p, err := sandbox.Resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return "", err
+	}
+	names := []string{}
+	for i, entry := range entries {
+		if i == maxListEntries {
+			names = append(names, truncatedNotice[1:])
+			break
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, "\n"), nil
+}
+
+func grep(sandbox *Sandbox, rawArgs json.RawMessage) (string, error) {
+	var args struct {
+		Pattern string `json:"pattern"`
+		Path    string `json:"path"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return "", err
+	}
+	re, err := regexp.Compile(args.Pattern)
+	if err != nil {
+		return "", err
+	}
+	p, err := sandbox.Resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+
+	matches := []string{}
+	errLimit := fmt.Errorf("match limit reached")
+	err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			// Skip hidden directories such as .git
+			if path != p && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 {
+			// Unreadable or binary
+			return nil
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		lineNo := 0
+		for scanner.Scan() {
+			lineNo++
+			if re.Match(scanner.Bytes()) {
+				matches = append(matches, fmt.Sprintf("%s:%d: %s", sandbox.Rel(path), lineNo, scanner.Text()))
+				if len(matches) >= maxGrepMatches {
+					return errLimit
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errLimit {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "No matches", nil
+	}
+	result := strings.Join(matches, "\n")
+	if err == errLimit {
+		result += truncatedNotice
+	}
+	return truncate(result, maxReadBytes), nil
+}
+
+func goDoc(sandbox *Sandbox, rawArgs json.RawMessage) (string, error) {
+	var args struct {
+		Package string `json:"package"`
+		Symbol  string `json:"symbol"`
+	}
+	if err := json.Unmarshal(rawArgs, &args); err != nil {
+		return "", err
+	}
+	cmdArgs := []string{"doc"}
+	for _, arg := range []string{args.Package, args.Symbol} {
+		if arg == "" {
+			continue
+		}
+		// Don't let the model pass flags to go doc
+		if strings.HasPrefix(arg, "-") {
+			return "", fmt.Errorf("invalid argument %q", arg)
+		}
+		cmdArgs = append(cmdArgs, arg)
+	}
+	// Local package paths must stay inside the project
+	if strings.HasPrefix(args.Package, ".") || filepath.IsAbs(args.Package) {
+		if _, err := sandbox.Resolve(args.Package); err != nil {
+			return "", err
+		}
+	}
+	if len(cmdArgs) == 1 {
+		return "", fmt.Errorf("package is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), goDocTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", cmdArgs...)
+	cmd.Dir = sandbox.Root
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return truncate(string(out), maxReadBytes), nil
+}
@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const commandTimeout = 5 * time.Minute
+
+var RunCommandParameters = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"command": map[string]interface{}{"type": "string", "description": "Shell command to run in the project root, e.g. go test ./..."},
+	},
+	"required": []string{"command"},
+}
+
+// RunCommand runs a shell command in the project root and returns its combined output.
+// A non-zero exit code is not an error, it is reported to the model like any other output.
+func RunCommand(sandbox *Sandbox, command string) (output string, exitCode int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Dir = sandbox.Root
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return truncate(string(out), maxReadBytes), -1, fmt.Errorf("command timed out after %v", commandTimeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return truncate(string(out), maxReadBytes), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return "", -1, err
+	}
+	return truncate(string(out), maxReadBytes), 0, nil
+}
+
+// FormatCommandResult formats the outcome of RunCommand as a tool result
+func FormatCommandResult(output string, exitCode int) string {
+	return fmt.Sprintf("exit code: %d\n%s", exitCode, strings.TrimRight(output, "\n"))
+}
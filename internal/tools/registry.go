@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// FunctionDefinition and Definition follow the OpenAI "tools" request format
+type FunctionDefinition struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type Definition struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+type Tool struct {
+	Name        string
+	Description string
+	// JSON schema of the arguments object
+	Parameters map[string]interface{}
+	Run        func(sandbox *Sandbox, args json.RawMessage) (string, error)
+}
+
+// Registry is safe for concurrent use. Tools are registered from the UI while an
+// answer that calls them streams.
+type Registry struct {
+	sandbox *Sandbox
+	mutex   sync.RWMutex
+	tools   map[string]Tool
+	order   []string
+}
+
+// NewRegistry creates a registry with the built-in read-only tools, sandboxed to root
+func NewRegistry(root string) (*Registry, error) {
+	sandbox, err := NewSandbox(root)
+	if err != nil {
+		return nil, err
+	}
+	registry := &Registry{
+		sandbox: sandbox,
+		tools:   map[string]Tool{},
+	}
+	for _, tool := range builtinTools() {
+		registry.Register(tool)
+	}
+	return registry, nil
+}
+
+func (registry *Registry) Sandbox() *Sandbox {
+	return registry.sandbox
+}
+
+// Register adds a tool, replacing any tool with the same name
+func (registry *Registry) Register(tool Tool) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, exists := registry.tools[tool.Name]; !exists {
+		registry.order = append(registry.order, tool.Name)
+	}
+	registry.tools[tool.Name] = tool
+}
+
+func (registry *Registry) Unregister(name string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, exists := registry.tools[name]; !exists {
+		return
+	}
+	delete(registry.tools, name)
+	for i, n := range registry.order {
+		if n == name {
+			registry.order = append(registry.order[:i], registry.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (registry *Registry) Definitions() []Definition {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	definitions := []Definition{}
+	for _, name := range registry.order {
+		tool := registry.tools[name]
+		definitions = append(definitions, Definition{
+			Type: "function",
+			Function: FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return definitions
+}
+
+// Call runs the tool requested by the model. Errors are returned as the result
+// text so that the model can see what went wrong and try again.
+func (registry *Registry) Call(call types.ToolCall) string {
+	registry.mutex.RLock()
+	tool, ok := registry.tools[call.Function.Name]
+	registry.mutex.RUnlock()
+	if !ok {
+		return fmt.Sprintf("Error: unknown tool %q", call.Function.Name)
+	}
+	args := json.RawMessage(call.Function.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	log.Printf("Calling tool %s(%s)", call.Function.Name, call.Function.Arguments)
+	result, err := tool.Run(registry.sandbox, args)
+	if err != nil {
+		log.Printf("Tool %s failed: %v", call.Function.Name, err)
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sandbox confines tool file access to a project root
+type Sandbox struct {
+	Root string
+}
+
+func NewSandbox(root string) (*Sandbox, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return nil, err
+	}
+	return &Sandbox{Root: realRoot}, nil
+}
+
+func (sandbox *Sandbox) contains(p string) bool {
+	rel, err := filepath.Rel(sandbox.Root, p)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// Resolve turns a path given by the model into an absolute path inside the root.
+// Relative paths are relative to the root. Symlinks pointing out of the root are rejected.
+func (sandbox *Sandbox) Resolve(p string) (string, error) {
+	if p == "" {
+		p = "."
+	}
+	var abs string
+	if filepath.IsAbs(p) {
+		abs = filepath.Clean(p)
+	} else {
+		abs = filepath.Join(sandbox.Root, p)
+	}
+	if !sandbox.contains(abs) {
+		return "", fmt.Errorf("path %q is outside of the project root", p)
+	}
+
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("path %q does not exist", p)
+		}
+		return "", err
+	}
+	if !sandbox.contains(real) {
+		return "", fmt.Errorf("path %q is outside of the project root", p)
+	}
+	return real, nil
+}
+
+// Rel returns p relative to the root, for display to the model
+func (sandbox *Sandbox) Rel(p string) string {
+	rel, err := filepath.Rel(sandbox.Root, p)
+	if err != nil {
+		return p
+	}
+	return rel
+}
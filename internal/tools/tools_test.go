@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func setupProject(t *testing.T) (root string, registry *Registry) {
+	root = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "pkg", "a.go"), []byte("package pkg\n\nfunc Hello() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	registry, err := NewRegistry(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, registry
+}
+
+func call(registry *Registry, name string, args string) string {
+	return registry.Call(types.ToolCall{ID: "1", Type: "function", Function: types.ToolCallFunction{Name: name, Arguments: args}})
+}
+
+func TestSandboxRejectsEscapes(t *testing.T) {
+	root, registry := setupProject(t)
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"../secret.txt", filepath.Join(outside, "secret.txt"), "link/secret.txt"} {
+		result := call(registry, "read_file", `{"path": "`+p+`"}`)
+		assert.True(t, strings.HasPrefix(result, "Error:"), "expected %q to be rejected, got %q", p, result)
+		assert.NotContains(t, result, "secret\n")
+	}
+}
+
+func TestReadFileAndLineRange(t *testing.T) {
+	_, registry := setupProject(t)
+	assert.Equal(t, "package pkg\n\nfunc Hello() {}\n", call(registry, "read_file", `{"path": "pkg/a.go"}`))
+	assert.Equal(t, "func Hello() {}", call(registry, "read_file", `{"path": "pkg/a.go", "start_line": 3, "end_line": 3}`))
+}
+
+func TestListDirAndGrep(t *testing.T) {
+	_, registry := setupProject(t)
+	assert.Equal(t, "pkg/", call(registry, "list_dir", `{}`))
+	assert.Equal(t, "pkg/a.go:3: func Hello() {}", call(registry, "grep", `{"pattern": "func \\w+"}`))
+	assert.Equal(t, "No matches", call(registry, "grep", `{"pattern": "nothing here"}`))
+}
+
+func TestUnknownTool(t *testing.T) {
+	_, registry := setupProject(t)
+	assert.Equal(t, `Error: unknown tool "rm"`, call(registry, "rm", `{}`))
+}
@@ -1,25 +1,50 @@
 package types
 
 import (
+	"fmt"
+
 	"gopkg.in/yaml.v2"
 
 	v1 "github.com/worldsayshi/cir/internal/types/v1"
 	v2 "github.com/worldsayshi/cir/internal/types/v2"
+	v3 "github.com/worldsayshi/cir/internal/types/v3"
+	v4 "github.com/worldsayshi/cir/internal/types/v4"
 	"github.com/worldsayshi/cir/internal/types/versionedtype"
 )
 
 type (
-	Message          = v2.Message
-	WorkingFile      = v2.WorkingFile
-	WorkingSession   = v2.WorkingSession
-	AiServiceMessage = v2.AiServiceMessage
+	Message          = v4.Message
+	Usage            = v4.Usage
+	WorkingFile      = v4.WorkingFile
+	WorkingSession   = v4.WorkingSession
+	AiServiceMessage = v4.AiServiceMessage
+	ToolCall         = v4.ToolCall
+	ToolCallFunction = v4.ToolCallFunction
+	AgentSettings    = v4.AgentSettings
+	ApprovalPolicy   = v4.ApprovalPolicy
+	CommandDecision  = v4.CommandDecision
+)
+
+const (
+	RoleUser      = v3.RoleUser
+	RoleSystem    = v3.RoleSystem
+	RoleAssistant = v3.RoleAssistant
+	RoleTool      = v3.RoleTool
+
+	ApprovalAlwaysAsk = v3.ApprovalAlwaysAsk
+	ApprovalAllowlist = v3.ApprovalAllowlist
+
+	DecisionApproved     = v3.DecisionApproved
+	DecisionEdited       = v3.DecisionEdited
+	DecisionRejected     = v3.DecisionRejected
+	DecisionAutoApproved = v3.DecisionAutoApproved
 )
 
 const (
-	CurrentApiVersion = versionedtype.V2
+	CurrentApiVersion = versionedtype.V4
 )
 
-func UnmarshalWorkingSession(data []byte) (workingSession *v2.WorkingSession, err error) {
+func UnmarshalWorkingSession(data []byte) (workingSession *v4.WorkingSession, err error) {
 	var vt versionedtype.VersionedType
 	if err = yaml.Unmarshal(data, &vt); err != nil {
 		return nil, err
@@ -39,14 +64,39 @@ func UnmarshalWorkingSession(data []byte) (workingSession *v2.WorkingSession, er
 		if err = yaml.UnmarshalStrict(data, &workingSessionV1); err != nil {
 			return nil, err
 		}
-		return ConvertWorkingSessionV1ToV2(&workingSessionV1)
+		workingSessionV2, err := ConvertWorkingSessionV1ToV2(&workingSessionV1)
+		if err != nil {
+			return nil, err
+		}
+		workingSessionV3, err := ConvertWorkingSessionV2ToV3(workingSessionV2)
+		if err != nil {
+			return nil, err
+		}
+		return ConvertWorkingSessionV3ToV4(workingSessionV3)
 	case versionedtype.V2:
+		var workingSessionV2 v2.WorkingSession
+		if err = yaml.Unmarshal(data, &workingSessionV2); err != nil {
+			return nil, err
+		}
+		workingSessionV3, err := ConvertWorkingSessionV2ToV3(&workingSessionV2)
+		if err != nil {
+			return nil, err
+		}
+		return ConvertWorkingSessionV3ToV4(workingSessionV3)
+	case versionedtype.V3:
+		var workingSessionV3 v3.WorkingSession
+		if err = yaml.Unmarshal(data, &workingSessionV3); err != nil {
+			return nil, err
+		}
+		return ConvertWorkingSessionV3ToV4(&workingSessionV3)
+	case versionedtype.V4:
 		if err = yaml.Unmarshal(data, &workingSession); err != nil {
 			return nil, err
 		}
+		workingSession.Messages = workingSession.Branch(workingSession.Head)
 		return workingSession, nil
 	default:
-		panic("Unknown API version: " + apiVersion)
+		return nil, fmt.Errorf("unknown API version: %s", apiVersion)
 	}
 }
 
@@ -72,6 +122,60 @@ func ConvertWorkingSessionV1ToV2(workingSessionV1 *v1.WorkingSession) (workingSe
 	return workingSessionV2, nil
 }
 
+// The flat v2 history becomes a tree with a single branch
+func ConvertWorkingSessionV2ToV3(workingSessionV2 *v2.WorkingSession) (workingSessionV3 *v3.WorkingSession, err error) {
+	var messagesV3 []v3.Message
+	for i, msgV2 := range workingSessionV2.Messages {
+		messagesV3 = append(messagesV3, v3.Message{
+			ID:     i + 1,
+			Parent: i,
+			AiServiceMessage: v3.AiServiceMessage{
+				Role:    msgV2.Role,
+				Content: msgV2.Content,
+			},
+			Question:             msgV2.Question,
+			IncludedWorkingFiles: convertWorkingFilesV2ToV3(msgV2.IncludedWorkingFiles),
+		})
+	}
+
+	workingSessionV3 = &v3.WorkingSession{
+		Messages:     messagesV3,
+		Tree:         messagesV3,
+		Head:         len(messagesV3),
+		WorkingFiles: convertWorkingFilesV2ToV3(workingSessionV2.WorkingFiles),
+		InputText:    workingSessionV2.InputText,
+	}
+
+	return workingSessionV3, nil
+}
+
+// Messages get metadata fields, which stay empty for old messages
+func ConvertWorkingSessionV3ToV4(workingSessionV3 *v3.WorkingSession) (workingSessionV4 *v4.WorkingSession, err error) {
+	var treeV4 []v4.Message
+	for _, msgV3 := range workingSessionV3.Tree {
+		treeV4 = append(treeV4, v4.Message{
+			ID:                   msgV3.ID,
+			Parent:               msgV3.Parent,
+			AiServiceMessage:     msgV3.AiServiceMessage,
+			Question:             msgV3.Question,
+			IncludedWorkingFiles: msgV3.IncludedWorkingFiles,
+		})
+	}
+
+	workingSessionV4 = &v4.WorkingSession{
+		Tree:         treeV4,
+		Head:         workingSessionV3.Head,
+		WorkingFiles: workingSessionV3.WorkingFiles,
+		InputText:    workingSessionV3.InputText,
+		Model:        workingSessionV3.Model,
+		Agent:        workingSessionV3.Agent,
+		CommandLog:   workingSessionV3.CommandLog,
+	}
+	workingSessionV4.Messages = workingSessionV4.Branch(workingSessionV4.Head)
+
+	return workingSessionV4, nil
+}
+
 func convertWorkingFilesV1ToV2(workingFilesV1 *[]v1.WorkingFile) *[]v2.WorkingFile {
 	var workingFilesV2 []v2.WorkingFile
 	for _, wfV1 := range *workingFilesV1 {
@@ -83,3 +187,15 @@ func convertWorkingFilesV1ToV2(workingFilesV1 *[]v1.WorkingFile) *[]v2.WorkingFi
 	}
 	return &workingFilesV2
 }
+
+func convertWorkingFilesV2ToV3(workingFilesV2 []v2.WorkingFile) []v3.WorkingFile {
+	var workingFilesV3 []v3.WorkingFile
+	for _, wfV2 := range workingFilesV2 {
+		workingFilesV3 = append(workingFilesV3, v3.WorkingFile{
+			Path:                  wfV2.Path,
+			LastSubmittedChecksum: wfV2.LastSubmittedChecksum,
+			FileContent:           wfV2.FileContent,
+		})
+	}
+	return workingFilesV3
+}
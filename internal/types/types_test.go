@@ -3,8 +3,10 @@ package types
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
 )
 
 func TestUnmarshalWorkingSessionV1(t *testing.T) {
@@ -39,3 +41,129 @@ working_files:
 	assert.Equal(t, 1, len(workingSession.WorkingFiles))
 	assert.Equal(t, "./test.txt", workingSession.WorkingFiles[0].Path)
 }
+
+func TestUnmarshalWorkingSessionV2(t *testing.T) {
+	yamlData := `
+apiVersion: v2
+messages:
+- aiServiceMessage:
+    role: user
+    content: <question>First</question>
+  question: First
+- aiServiceMessage:
+    role: system
+    content: First answer
+working_files:
+- path: ./test.txt
+input_text: Second
+`
+
+	workingSession, err := UnmarshalWorkingSession([]byte(yamlData))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(workingSession.Messages))
+	assert.Equal(t, 2, len(workingSession.Tree))
+	assert.Equal(t, workingSession.Messages[0].ID, workingSession.Messages[1].Parent)
+	assert.Equal(t, workingSession.Messages[1].ID, workingSession.Head)
+	assert.Equal(t, "./test.txt", workingSession.WorkingFiles[0].Path)
+	assert.Equal(t, "Second", workingSession.InputText)
+}
+
+func TestBranching(t *testing.T) {
+	question := func(q string) Message {
+		return Message{AiServiceMessage: AiServiceMessage{Role: RoleUser, Content: q}, Question: q}
+	}
+	answer := func(a string) Message {
+		return Message{AiServiceMessage: AiServiceMessage{Role: RoleSystem, Content: a}}
+	}
+	ws := &WorkingSession{Messages: []Message{question("q1"), answer("a1"), question("q2"), answer("a2")}}
+	ws.Sync()
+
+	// Edit the second question into a new branch
+	ws.Fork(2)
+	ws.Messages = append(ws.Messages, question("q2 edited"), answer("a2 edited"))
+	ws.Sync()
+	assert.Equal(t, 6, len(ws.Tree))
+	assert.Equal(t, 4, len(ws.Messages))
+
+	siblings, pos := ws.Siblings(2)
+	assert.Equal(t, 2, len(siblings))
+	assert.Equal(t, 1, pos)
+	all, positions := ws.BranchSiblings()
+	assert.Equal(t, siblings, all[2])
+	assert.Equal(t, []int{0, 0, 1, 0}, positions)
+
+	// Go back to the original branch
+	ws.Checkout(siblings[0])
+	assert.Equal(t, "q2", ws.Messages[2].Question)
+	assert.Equal(t, "a2", ws.Messages[3].Content)
+	assert.Equal(t, ws.Messages[3].ID, ws.Head)
+
+	// The tree survives a round trip
+	apiVersion := CurrentApiVersion
+	ws.ApiVersion = &apiVersion
+	data, err := yaml.Marshal(ws)
+	assert.NoError(t, err)
+	loaded, err := UnmarshalWorkingSession(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(loaded.Tree))
+	assert.Equal(t, "a2", loaded.Messages[3].Content)
+}
+
+func TestUnmarshalWorkingSessionV3(t *testing.T) {
+	yamlData := `
+apiVersion: v3
+messages:
+- id: 1
+  aiServiceMessage:
+    role: user
+    content: <question>First</question>
+  question: First
+- id: 2
+  parent: 1
+  aiServiceMessage:
+    role: system
+    content: First answer
+head: 2
+model: gpt-4o
+`
+
+	workingSession, err := UnmarshalWorkingSession([]byte(yamlData))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(workingSession.Messages))
+	assert.Equal(t, "First answer", workingSession.Messages[1].Content)
+	assert.Equal(t, "gpt-4o", workingSession.Model)
+	assert.Nil(t, workingSession.Messages[1].Time)
+	assert.Nil(t, workingSession.Messages[1].Usage)
+
+	// Metadata survives a round trip
+	answered := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	workingSession.Messages[1].Time = &answered
+	workingSession.Messages[1].Model = "gpt-4o"
+	workingSession.Messages[1].TimeToFirstToken = 300 * time.Millisecond
+	workingSession.Messages[1].Usage = &Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	workingSession.Sync()
+	apiVersion := CurrentApiVersion
+	workingSession.ApiVersion = &apiVersion
+	data, err := yaml.Marshal(workingSession)
+	assert.NoError(t, err)
+	loaded, err := UnmarshalWorkingSession(data)
+	assert.NoError(t, err)
+	assert.Equal(t, workingSession.Messages, loaded.Messages)
+}
+
+func TestBranchLongHistory(t *testing.T) {
+	ws := &WorkingSession{}
+	for i := 0; i < 10000; i++ {
+		ws.Messages = append(ws.Messages, Message{AiServiceMessage: AiServiceMessage{Role: RoleUser, Content: "q"}})
+	}
+	ws.Sync()
+	// Store the tree newest first, as an import might
+	for i, j := 0, len(ws.Tree)-1; i < j; i, j = i+1, j-1 {
+		ws.Tree[i], ws.Tree[j] = ws.Tree[j], ws.Tree[i]
+	}
+
+	branch := ws.Branch(1)
+	assert.Equal(t, 10000, len(branch))
+	assert.Equal(t, 1, branch[0].ID)
+	assert.Equal(t, ws.Head, branch[len(branch)-1].ID)
+}
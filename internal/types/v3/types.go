@@ -0,0 +1,100 @@
+package v3
+
+import (
+	"time"
+
+	"github.com/worldsayshi/cir/internal/types/versionedtype"
+)
+
+// Roles used in AiServiceMessage.Role
+const (
+	RoleUser      = "user"
+	RoleSystem    = "system"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+type ToolCallFunction struct {
+	Name      string `json:"name" yaml:"name"`
+	Arguments string `json:"arguments" yaml:"arguments"`
+}
+
+type ToolCall struct {
+	ID       string           `json:"id" yaml:"id"`
+	Type     string           `json:"type" yaml:"type"`
+	Function ToolCallFunction `json:"function" yaml:"function"`
+}
+
+type AiServiceMessage struct {
+	Role       string     `json:"role" yaml:"role"`
+	Content    string     `json:"content" yaml:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty" yaml:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty" yaml:"tool_call_id,omitempty"`
+}
+
+type WorkingFile struct {
+	Path                  string  `json:"path" yaml:"path"`
+	LastSubmittedChecksum *string `json:"last_submitted_checksum,omitempty" yaml:"last_submitted_checksum,omitempty"`
+	FileContent           []byte  `json:"-" yaml:"-"` // Don't serialize this field
+	// Set for MCP resources, then Path is the resource URI
+	McpServer string `json:"mcp_server,omitempty" yaml:"mcp_server,omitempty"`
+	// Set for context added by plugins, which has no file behind it
+	InlineContent string `json:"inline_content,omitempty" yaml:"inline_content,omitempty"`
+}
+
+type Message struct {
+	// Zero until the message is first saved
+	ID int `json:"id" yaml:"id"`
+	// ID of the message this one follows, zero for the first message of a branch from the start
+	Parent               int `json:"parent,omitempty" yaml:"parent,omitempty"`
+	AiServiceMessage     `json:"aiServiceMessage,omitempty" yaml:"aiServiceMessage,omitempty"`
+	Question             string        `json:"question,omitempty" yaml:"question,omitempty"`
+	IncludedWorkingFiles []WorkingFile `json:"included_working_files,omitempty" yaml:"included_working_files,omitempty"`
+}
+
+// Approval policy modes for commands proposed in agent mode
+const (
+	ApprovalAlwaysAsk = "always_ask"
+	ApprovalAllowlist = "allowlist"
+)
+
+// Decisions recorded in the command log
+const (
+	DecisionApproved     = "approved"
+	DecisionEdited       = "edited"
+	DecisionRejected     = "rejected"
+	DecisionAutoApproved = "auto_approved"
+)
+
+type ApprovalPolicy struct {
+	Mode            string   `json:"mode" yaml:"mode"`
+	AllowedPrefixes []string `json:"allowed_prefixes,omitempty" yaml:"allowed_prefixes,omitempty"`
+}
+
+type AgentSettings struct {
+	Enabled        bool           `json:"enabled" yaml:"enabled"`
+	ApprovalPolicy ApprovalPolicy `json:"approval_policy" yaml:"approval_policy"`
+}
+
+type CommandDecision struct {
+	Time            time.Time `json:"time" yaml:"time"`
+	ProposedCommand string    `json:"proposed_command" yaml:"proposed_command"`
+	Command         string    `json:"command,omitempty" yaml:"command,omitempty"` // What was actually run, if anything
+	Decision        string    `json:"decision" yaml:"decision"`
+	ExitCode        *int      `json:"exit_code,omitempty" yaml:"exit_code,omitempty"`
+}
+
+type WorkingSession struct {
+	*versionedtype.ApiVersion `json:"apiVersion" yaml:"apiVersion"`
+	// The current branch, first message first. Saved as part of Tree.
+	Messages []Message `json:"-" yaml:"-"`
+	// Every message of every branch
+	Tree []Message `json:"messages" yaml:"messages"`
+	// Last message of the current branch
+	Head         int               `json:"head,omitempty" yaml:"head,omitempty"`
+	WorkingFiles []WorkingFile     `json:"working_files" yaml:"working_files"`
+	InputText    string            `json:"input_text" yaml:"input_text"`
+	Model        string            `json:"model,omitempty" yaml:"model,omitempty"` // Empty means the default model
+	Agent        *AgentSettings    `json:"agent,omitempty" yaml:"agent,omitempty"`
+	CommandLog   []CommandDecision `json:"command_log,omitempty" yaml:"command_log,omitempty"`
+}
@@ -0,0 +1,179 @@
+package v4
+
+// Sync writes the current branch into the tree, giving new messages an ID
+func (ws *WorkingSession) Sync() {
+	index := map[int]int{}
+	nextID := 1
+	for i, msg := range ws.Tree {
+		index[msg.ID] = i
+		if msg.ID >= nextID {
+			nextID = msg.ID + 1
+		}
+	}
+	parent := 0
+	for i := range ws.Messages {
+		msg := &ws.Messages[i]
+		if msg.ID == 0 {
+			msg.ID = nextID
+			nextID++
+		}
+		msg.Parent = parent
+		parent = msg.ID
+		if j, ok := index[msg.ID]; ok {
+			ws.Tree[j] = *msg
+		} else {
+			index[msg.ID] = len(ws.Tree)
+			ws.Tree = append(ws.Tree, *msg)
+		}
+	}
+	ws.Head = parent
+}
+
+// treeIndex finds messages of the tree by ID without scanning it, so that walking a
+// branch of a long history stays linear. It is built for one operation at a time,
+// the tree changes in between.
+type treeIndex struct {
+	tree []Message
+	// Position of each message in the tree
+	positions map[int]int
+	// The IDs of the children of each message, oldest first
+	children map[int][]int
+}
+
+func (ws *WorkingSession) index() treeIndex {
+	index := treeIndex{
+		tree:      ws.Tree,
+		positions: make(map[int]int, len(ws.Tree)),
+		children:  map[int][]int{},
+	}
+	for i, msg := range ws.Tree {
+		index.positions[msg.ID] = i
+		index.children[msg.Parent] = append(index.children[msg.Parent], msg.ID)
+	}
+	return index
+}
+
+func (index treeIndex) find(id int) (Message, bool) {
+	i, ok := index.positions[id]
+	if !ok {
+		return Message{}, false
+	}
+	return index.tree[i], true
+}
+
+// Children returns the IDs of the messages that follow the given one, oldest first.
+// Zero gives the first messages of all branches.
+func (ws *WorkingSession) Children(id int) []int {
+	return append([]int{}, ws.index().children[id]...)
+}
+
+// Siblings returns the IDs of the alternatives to the message at idx in the current
+// branch, including itself, and the position of the message among them
+func (ws *WorkingSession) Siblings(idx int) ([]int, int) {
+	return ws.index().siblings(ws.Messages[idx])
+}
+
+// BranchSiblings is Siblings for every message of the current branch, looking
+// through the tree once rather than for each message
+func (ws *WorkingSession) BranchSiblings() ([][]int, []int) {
+	index := ws.index()
+	siblings := make([][]int, len(ws.Messages))
+	positions := make([]int, len(ws.Messages))
+	for i, msg := range ws.Messages {
+		siblings[i], positions[i] = index.siblings(msg)
+	}
+	return siblings, positions
+}
+
+func (index treeIndex) siblings(msg Message) ([]int, int) {
+	if msg.ID == 0 {
+		// Not saved yet
+		return []int{0}, 0
+	}
+	siblings := index.children[msg.Parent]
+	for i, id := range siblings {
+		if id == msg.ID {
+			return siblings, i
+		}
+	}
+	return []int{msg.ID}, 0
+}
+
+// Branch returns the messages from the start through the given message,
+// continuing to the newest leaf below it
+func (ws *WorkingSession) Branch(id int) []Message {
+	index := ws.index()
+	path := []Message{}
+	for msg, ok := index.find(id); ok; msg, ok = index.find(msg.Parent) {
+		path = append(path, msg)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	for {
+		children := index.children[id]
+		if len(children) == 0 {
+			return path
+		}
+		id = children[len(children)-1]
+		msg, _ := index.find(id)
+		path = append(path, msg)
+	}
+}
+
+// Checkout makes the branch through the given message current
+func (ws *WorkingSession) Checkout(id int) {
+	ws.Sync()
+	ws.Messages = ws.Branch(id)
+	ws.Head = 0
+	if len(ws.Messages) > 0 {
+		ws.Head = ws.Messages[len(ws.Messages)-1].ID
+	}
+	ws.resetChecksums()
+}
+
+// Fork cuts the current branch before the message at idx so the next message
+// starts a new branch. The old branch stays in the tree.
+func (ws *WorkingSession) Fork(idx int) {
+	ws.Sync()
+	ws.Messages = ws.Messages[:idx:idx]
+	ws.Head = 0
+	if idx > 0 {
+		ws.Head = ws.Messages[idx-1].ID
+	}
+	ws.resetChecksums()
+}
+
+// Remove deletes a message and everything below it from the tree. Zero isn't a
+// message, messages without an ID aren't in the tree yet.
+func (ws *WorkingSession) Remove(id int) {
+	if id == 0 {
+		return
+	}
+	removed := map[int]bool{id: true}
+	tree := []Message{}
+	// Parents come before their children
+	for _, msg := range ws.Tree {
+		if removed[msg.ID] || removed[msg.Parent] {
+			removed[msg.ID] = true
+			continue
+		}
+		tree = append(tree, msg)
+	}
+	ws.Tree = tree
+}
+
+// Point the working file checksums at what the current branch last sent,
+// so files are sent again if this branch never saw them
+func (ws *WorkingSession) resetChecksums() {
+	sent := map[string]*string{}
+	for _, msg := range ws.Messages {
+		for _, wf := range msg.IncludedWorkingFiles {
+			sent[wf.McpServer+":"+wf.Path] = wf.LastSubmittedChecksum
+		}
+	}
+	for i := range ws.WorkingFiles {
+		wf := &ws.WorkingFiles[i]
+		wf.LastSubmittedChecksum = sent[wf.McpServer+":"+wf.Path]
+	}
+}
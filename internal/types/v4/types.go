@@ -0,0 +1,60 @@
+package v4
+
+import (
+	"time"
+
+	v3 "github.com/worldsayshi/cir/internal/types/v3"
+	"github.com/worldsayshi/cir/internal/types/versionedtype"
+)
+
+// Unchanged since v3
+type (
+	AiServiceMessage = v3.AiServiceMessage
+	ToolCall         = v3.ToolCall
+	ToolCallFunction = v3.ToolCallFunction
+	WorkingFile      = v3.WorkingFile
+	AgentSettings    = v3.AgentSettings
+	ApprovalPolicy   = v3.ApprovalPolicy
+	CommandDecision  = v3.CommandDecision
+)
+
+// Tokens used by a completion, as reported by the provider
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens" yaml:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens" yaml:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens" yaml:"total_tokens"`
+}
+
+type Message struct {
+	// Zero until the message is first saved
+	ID int `json:"id" yaml:"id"`
+	// ID of the message this one follows, zero for the first message of a branch from the start
+	Parent               int `json:"parent,omitempty" yaml:"parent,omitempty"`
+	AiServiceMessage     `json:"aiServiceMessage,omitempty" yaml:"aiServiceMessage,omitempty"`
+	Question             string        `json:"question,omitempty" yaml:"question,omitempty"`
+	IncludedWorkingFiles []WorkingFile `json:"included_working_files,omitempty" yaml:"included_working_files,omitempty"`
+	// When the message was written, if known
+	Time *time.Time `json:"time,omitempty" yaml:"time,omitempty"`
+	// What produced an answer
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"`
+	Model    string `json:"model,omitempty" yaml:"model,omitempty"`
+	// From sending the request to the first streamed chunk, and to the end of the stream
+	TimeToFirstToken time.Duration `json:"time_to_first_token,omitempty" yaml:"time_to_first_token,omitempty"`
+	Duration         time.Duration `json:"duration,omitempty" yaml:"duration,omitempty"`
+	Usage            *Usage        `json:"usage,omitempty" yaml:"usage,omitempty"`
+}
+
+type WorkingSession struct {
+	*versionedtype.ApiVersion `json:"apiVersion" yaml:"apiVersion"`
+	// The current branch, first message first. Saved as part of Tree.
+	Messages []Message `json:"-" yaml:"-"`
+	// Every message of every branch
+	Tree []Message `json:"messages" yaml:"messages"`
+	// Last message of the current branch
+	Head         int               `json:"head,omitempty" yaml:"head,omitempty"`
+	WorkingFiles []WorkingFile     `json:"working_files" yaml:"working_files"`
+	InputText    string            `json:"input_text" yaml:"input_text"`
+	Model        string            `json:"model,omitempty" yaml:"model,omitempty"` // Empty means the default model
+	Agent        *AgentSettings    `json:"agent,omitempty" yaml:"agent,omitempty"`
+	CommandLog   []CommandDecision `json:"command_log,omitempty" yaml:"command_log,omitempty"`
+}
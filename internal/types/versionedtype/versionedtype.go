@@ -5,6 +5,8 @@ type ApiVersion string
 const (
 	V1 ApiVersion = "v1"
 	V2 ApiVersion = "v2"
+	V3 ApiVersion = "v3"
+	V4 ApiVersion = "v4"
 )
 
 type VersionedType struct {
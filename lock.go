@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// sessionLock is an advisory lock that keeps two cir processes from writing the same
+// session. It is taken on a separate file since saving replaces the session file.
+type sessionLock struct {
+	file *os.File
+}
+
+func sessionLockFile(sessionFile string) string {
+	return filepath.Join(filepath.Dir(sessionFile), "."+filepath.Base(sessionFile)+".lock")
+}
+
+func lockSession(sessionFile string) (*sessionLock, error) {
+	if err := os.MkdirAll(filepath.Dir(sessionFile), 0755); err != nil {
+		return nil, err
+	}
+	// The lock file is left behind, removing it would let two processes lock different files
+	f, err := os.OpenFile(sessionLockFile(sessionFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := tryLockFile(f)
+	if err != nil || !locked {
+		f.Close()
+		if err == nil {
+			err = fmt.Errorf("session %s is open in another cir process", sessionFile)
+		}
+		return nil, err
+	}
+	return &sessionLock{file: f}, nil
+}
+
+func (lock *sessionLock) release() {
+	if lock == nil {
+		return
+	}
+	unlockFile(lock.file)
+	lock.file.Close()
+}
+
+// withSessionLock runs f while holding the lock of a session
+func withSessionLock(sessionFile string, f func() error) error {
+	return withSessionLocks([]string{sessionFile}, f)
+}
+
+// withSessionLocks runs f while holding the locks of all the sessions, like the source
+// and destination of a copy
+func withSessionLocks(sessionFiles []string, f func() error) error {
+	for _, sessionFile := range sessionFiles {
+		lock, err := lockSession(sessionFile)
+		if err != nil {
+			return err
+		}
+		defer lock.release()
+	}
+	return f()
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// No advisory locks here, sessions are only protected by the modification check
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
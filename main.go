@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path"
@@ -23,7 +24,64 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	sessionFile := flag.String("session", path.Join(homedir, ".cir/default-session.yaml"), "path to the session file")
+	cirDir := path.Join(homedir, ".cir")
+	defaultSessionFile := path.Join(cirDir, "default-session.yaml")
+	defaultConfigFile := path.Join(cirDir, configFileName)
+
+	if len(os.Args) > 1 {
+		var run func() error
+		// Commands without a -config flag use the store of the default config
+		withStore := func(run func(store SessionStore) error) func() error {
+			return func() error {
+				config, err := loadConfig(defaultConfigFile)
+				if err != nil {
+					return fmt.Errorf("loading config: %w", err)
+				}
+				store, err := openSessionStore(cirDir, config)
+				if err != nil {
+					return err
+				}
+				defer store.Close()
+				return run(store)
+			}
+		}
+		switch os.Args[1] {
+		case "ask":
+			run = func() error { return runAsk(cirDir, defaultSessionFile, defaultConfigFile, os.Args[2:]) }
+		case "regenerate":
+			run = func() error { return runRegenerate(cirDir, defaultSessionFile, defaultConfigFile, os.Args[2:]) }
+		case "import":
+			run = withStore(func(store SessionStore) error { return runImport(store, cirDir, os.Args[2:], os.Stdout) })
+		case "search":
+			run = func() error { return runSearch(cirDir, defaultConfigFile, os.Args[2:], os.Stdout) }
+		case "sessions":
+			run = withStore(func(store SessionStore) error { return runSessions(store, cirDir, os.Args[2:], os.Stdout) })
+		case "context":
+			run = withStore(func(store SessionStore) error {
+				return runContext(store, cirDir, defaultSessionFile, os.Args[2:], os.Stdout)
+			})
+		case "export":
+			run = withStore(func(store SessionStore) error {
+				return runExport(store, cirDir, defaultSessionFile, os.Args[2:], os.Stdout)
+			})
+		}
+		if run != nil {
+			logfile, err := setupLogging()
+			if err != nil {
+				panic(err)
+			}
+			err = run()
+			logfile.Close()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	sessionFile := flag.String("session", defaultSessionFile, "path to the session file")
+	configFile := flag.String("config", defaultConfigFile, "path to the config file")
 	flag.Parse()
 
 	logfile, err := setupLogging()
@@ -32,7 +90,19 @@ func main() {
 	}
 	defer logfile.Close()
 
-	cirApp := NewCirApplication(*sessionFile)
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("error loading config: %v", err)
+	}
+
+	store, err := openSessionStore(cirDir, config)
+	if err != nil {
+		log.Fatalf("error opening session store: %v", err)
+	}
+	defer store.Close()
+
+	cirApp := NewCirApplication(store, *sessionFile, config, newSpendTracker(cirDir, config.Spending))
+	cirApp.sessionsDir = cirDir
 
 	if err := cirApp.Run(); err != nil {
 		panic(err)
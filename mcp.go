@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/worldsayshi/cir/internal/components"
+	"github.com/worldsayshi/cir/internal/mcp"
+	"github.com/worldsayshi/cir/internal/tools"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// OpenAI tool names must match ^[a-zA-Z0-9_-]{1,64}$
+func mcpToolName(server string, tool string) string {
+	name := invalidToolNameChars.ReplaceAllString(server+"__"+tool, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// Start the configured MCP servers. Servers that fail to start are logged and skipped.
+func startMCPServers(servers map[string]MCPServerConfig) map[string]*mcp.Client {
+	clients := map[string]*mcp.Client{}
+	for _, name := range sortedKeys(servers) {
+		server := servers[name]
+		client, err := mcp.Start(name, server.Command, server.Args, server.Env)
+		if err != nil {
+			log.Printf("Error starting mcp server %s: %v", name, err)
+			continue
+		}
+		clients[name] = client
+	}
+	return clients
+}
+
+// Expose the tools of the MCP servers to the model
+func registerMCPTools(registry *tools.Registry, clients map[string]*mcp.Client) {
+	for _, name := range sortedKeys(clients) {
+		client := clients[name]
+		mcpTools, err := client.ListTools()
+		if err != nil {
+			log.Printf("Error listing tools of mcp server %s: %v", name, err)
+			continue
+		}
+		for _, tool := range mcpTools {
+			toolName := tool.Name
+			parameters := tool.InputSchema
+			if parameters == nil {
+				parameters = map[string]interface{}{"type": "object"}
+			}
+			registry.Register(tools.Tool{
+				Name:        mcpToolName(name, toolName),
+				Description: tool.Description,
+				Parameters:  parameters,
+				Run: func(sandbox *tools.Sandbox, args json.RawMessage) (string, error) {
+					return client.CallTool(toolName, args)
+				},
+			})
+		}
+	}
+}
+
+func closeMCPClients(clients map[string]*mcp.Client) {
+	for name, client := range clients {
+		if err := client.Close(); err != nil {
+			log.Printf("Error closing mcp server %s: %v", name, err)
+		}
+	}
+}
+
+// Read a working file, from disk or from the MCP server it belongs to
+func (c *chat) readWorkingFile(wf types.WorkingFile) ([]byte, error) {
+	if wf.InlineContent != "" {
+		return []byte(wf.InlineContent), nil
+	}
+	if wf.McpServer == "" {
+		return readLocalFile(wf)
+	}
+	client, ok := c.mcpClients[wf.McpServer]
+	if !ok {
+		return nil, fmt.Errorf("mcp server %s is not connected", wf.McpServer)
+	}
+	text, err := client.ReadResource(wf.Path)
+	return []byte(text), err
+}
+
+// List resources and prompts of all servers and let the user pick one.
+// Resources are toggled in the working set, prompts are inserted in the input.
+func (cirApp *CirApplication) openMCPPicker() {
+	items := []components.PickerItem{}
+	for _, name := range sortedKeys(cirApp.mcpClients) {
+		client := cirApp.mcpClients[name]
+		resources, err := client.ListResources()
+		if err != nil {
+			log.Printf("Error listing resources of mcp server %s: %v", name, err)
+		}
+		for _, resource := range resources {
+			resource := resource
+			server := name
+			items = append(items, components.PickerItem{
+				Text:      fmt.Sprintf("[resource] %s: %s", server, resource.Name),
+				Secondary: resource.URI,
+				Selected: func() {
+					cirApp.toggleMCPResource(server, resource.URI)
+				},
+			})
+		}
+		prompts, err := client.ListPrompts()
+		if err != nil {
+			log.Printf("Error listing prompts of mcp server %s: %v", name, err)
+		}
+		for _, prompt := range prompts {
+			prompt := prompt
+			client := client
+			items = append(items, components.PickerItem{
+				Text:      fmt.Sprintf("[prompt] %s: %s", name, prompt.Name),
+				Secondary: prompt.Description,
+				Selected: func() {
+					cirApp.insertMCPPrompt(client, prompt)
+				},
+			})
+		}
+	}
+
+	picker := components.NewPicker("MCP resources and prompts", items, func() {
+		cirApp.pages.RemovePage("picker")
+		cirApp.SetFocus(cirApp.inputArea)
+	})
+	cirApp.pages.AddPage("picker", components.Centered(picker, 100, 20), true, true)
+	cirApp.SetFocus(picker)
+}
+
+// Ask for the arguments the prompt declares, if any, and insert the rendered prompt in
+// the input
+func (cirApp *CirApplication) insertMCPPrompt(client *mcp.Client, prompt mcp.Prompt) {
+	insert := func(arguments map[string]string) {
+		text, err := client.GetPrompt(prompt.Name, arguments)
+		if err != nil {
+			log.Printf("Error getting prompt %s: %v", prompt.Name, err)
+			cirApp.showTextModal("Error getting prompt "+prompt.Name, err.Error())
+			return
+		}
+		cirApp.pages.RemovePage("picker")
+		cirApp.inputArea.SetText(cirApp.inputArea.GetText()+text, true)
+		cirApp.SetFocus(cirApp.inputArea)
+	}
+	if len(prompt.Arguments) == 0 {
+		insert(map[string]string{})
+		return
+	}
+
+	arguments := []components.Argument{}
+	for _, argument := range prompt.Arguments {
+		arguments = append(arguments, components.Argument{Name: argument.Name, Description: argument.Description, Required: argument.Required})
+	}
+	previousFocus := cirApp.GetFocus()
+	dialog := components.NewArgumentsDialog("Arguments of "+prompt.Name, arguments, func(values map[string]string, ok bool) {
+		cirApp.pages.RemovePage("arguments")
+		cirApp.SetFocus(previousFocus)
+		if !ok {
+			return
+		}
+		values, missing := promptArgumentValues(prompt, values)
+		if len(missing) > 0 {
+			cirApp.showTextModal("Error getting prompt "+prompt.Name, "Missing required arguments: "+strings.Join(missing, ", "))
+			return
+		}
+		insert(values)
+	})
+	cirApp.pages.AddPage("arguments", components.Centered(dialog, 80, 2*len(arguments)+5), true, true)
+	cirApp.SetFocus(dialog)
+}
+
+// The values to send for the arguments of a prompt, leaving out empty ones, and the
+// required arguments that have no value
+func promptArgumentValues(prompt mcp.Prompt, values map[string]string) (map[string]string, []string) {
+	send := map[string]string{}
+	missing := []string{}
+	for _, argument := range prompt.Arguments {
+		if value := values[argument.Name]; value != "" {
+			send[argument.Name] = value
+		} else if argument.Required {
+			missing = append(missing, argument.Name)
+		}
+	}
+	return send, missing
+}
+
+func (cirApp *CirApplication) toggleMCPResource(server string, uri string) {
+	workingFiles := []types.WorkingFile{}
+	found := false
+	for _, wf := range cirApp.workingSession.WorkingFiles {
+		if wf.McpServer == server && wf.Path == uri {
+			found = true
+			continue
+		}
+		workingFiles = append(workingFiles, wf)
+	}
+	if !found {
+		workingFiles = append(workingFiles, types.WorkingFile{Path: uri, McpServer: server})
+	}
+	cirApp.setWorkingFiles(workingFiles)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
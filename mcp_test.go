@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/mcp"
+)
+
+func TestPromptArgumentValues(t *testing.T) {
+	prompt := mcp.Prompt{Name: "review", Arguments: []mcp.PromptArgument{
+		{Name: "file", Required: true},
+		{Name: "focus"},
+		{Name: "language", Required: true},
+	}}
+	values, missing := promptArgumentValues(prompt, map[string]string{"file": "main.go", "focus": ""})
+	if len(values) != 1 || values["file"] != "main.go" {
+		t.Fatalf("Expected only the filled in arguments to be sent, got %v", values)
+	}
+	if len(missing) != 1 || missing[0] != "language" {
+		t.Fatalf("Expected the missing required argument, got %v", missing)
+	}
+}
@@ -1,38 +1,108 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/worldsayshi/cir/internal/sse"
+	"github.com/worldsayshi/cir/internal/tools"
 	"github.com/worldsayshi/cir/internal/types"
 )
 
+const (
+	defaultModel   = "gpt-4o-2024-08-06"
+	openAIProvider = "openai"
+	openAIBaseURL  = "https://api.openai.com/v1"
+	maxRetries     = 4
+	maxRetryDelay  = time.Minute
+)
+
+// The first retry waits this long, each one after twice as long as the one before
+var retryBaseDelay = time.Second
+
 type OpenAIRequest struct {
-	Model    string                   `json:"model"`
-	Messages []types.AiServiceMessage `json:"messages"`
-	Stream   bool                     `json:"stream"`
+	Model         string                   `json:"model"`
+	Messages      []types.AiServiceMessage `json:"messages"`
+	Stream        bool                     `json:"stream"`
+	StreamOptions *streamOptions           `json:"stream_options,omitempty"`
+	Tools         []tools.Definition       `json:"tools,omitempty"`
+	Temperature   *float64                 `json:"temperature,omitempty"`
+}
+
+type streamOptions struct {
+	// Ask for a last chunk with the token usage of the whole completion
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// Settings for a single completion. A nil temperature leaves it to the API.
+type completionOptions struct {
+	Model       string
+	Temperature *float64
 }
 
-func streamOpenAI(messages []types.AiServiceMessage) (chan string, chan error) {
+type toolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// Tool calls are streamed in fragments keyed by index, merge them into complete calls
+func mergeToolCallDeltas(toolCalls []types.ToolCall, deltas []toolCallDelta) []types.ToolCall {
+	for _, delta := range deltas {
+		for len(toolCalls) <= delta.Index {
+			toolCalls = append(toolCalls, types.ToolCall{Type: "function"})
+		}
+		call := &toolCalls[delta.Index]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+	return toolCalls
+}
+
+// streamOpenAI streams content chunks on the first channel. If the model decides
+// to call tools, the complete tool calls are sent on the second channel before
+// the stream is closed. The token usage is put on the buffered third channel
+// before the stream is closed, if the API reports it. Cancelling ctx stops the
+// stream with ctx's error.
+func streamOpenAI(ctx context.Context, options completionOptions, messages []types.AiServiceMessage, toolDefinitions []tools.Definition) (chan string, chan []types.ToolCall, chan types.Usage, chan error) {
 	resultChan := make(chan string)
+	toolCallChan := make(chan []types.ToolCall)
+	usageChan := make(chan types.Usage, 1)
 	errChan := make(chan error)
 
 	go func() {
 		defer close(resultChan)
+		defer close(toolCallChan)
 		defer close(errChan)
 
 		openAIMessages := messages[:]
 
 		reqBody := OpenAIRequest{
-			Model:    "gpt-4o-2024-08-06",
-			Messages: openAIMessages,
-			Stream:   true,
+			Model:         options.Model,
+			Messages:      openAIMessages,
+			Stream:        true,
+			StreamOptions: &streamOptions{IncludeUsage: true},
+			Tools:         toolDefinitions,
+			Temperature:   options.Temperature,
 		}
 
 		jsonData, err := json.Marshal(reqBody)
@@ -42,13 +112,6 @@ func streamOpenAI(messages []types.AiServiceMessage) (chan string, chan error) {
 			return
 		}
 
-		req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
-		if err != nil {
-			log.Println("Error creating request:", err)
-			errChan <- err
-			return
-		}
-
 		apiKey := os.Getenv("OPENAI_API_KEY")
 		if apiKey == "" {
 			log.Println("OPENAI_API_KEY environment variable not set")
@@ -56,11 +119,7 @@ func streamOpenAI(messages []types.AiServiceMessage) (chan string, chan error) {
 			return
 		}
 
-		req.Header.Set("Authorization", "Bearer "+apiKey)
-		req.Header.Set("Content-Type", "application/json")
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := postWithRetry(ctx, apiKey, jsonData)
 		if err != nil {
 			log.Println("Error sending request:", err)
 			errChan <- err
@@ -69,42 +128,50 @@ func streamOpenAI(messages []types.AiServiceMessage) (chan string, chan error) {
 
 		defer resp.Body.Close()
 
-		reader := bufio.NewReader(resp.Body)
+		toolCalls := []types.ToolCall{}
+		finishReason := ""
+		reader := sse.NewReader(resp.Body)
 		for {
-			line, err := reader.ReadBytes('\n')
+			event, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
 			if err != nil {
-				if err == io.EOF {
-					break
+				if ctx.Err() != nil {
+					err = ctx.Err()
 				}
 				log.Println("Error reading response:", err)
 				errChan <- err
 				return
 			}
 
-			// Why is this prefix here?
-			line = bytes.TrimPrefix(bytes.TrimSpace(line), []byte("data: "))
-
-			if len(line) == 0 {
-				continue
+			// The usage chunk comes after the one with the finish reason
+			if event.Data == "[DONE]" {
+				break
 			}
 
 			var chunk struct {
 				Choices []struct {
 					Delta struct {
-						Content string `json:"content"`
+						Content   string          `json:"content"`
+						ToolCalls []toolCallDelta `json:"tool_calls"`
 					} `json:"delta"`
 					FinishReason *string `json:"finish_reason"`
 				} `json:"choices"`
+				Usage *types.Usage `json:"usage"`
+				Error *apiError    `json:"error"`
 			}
-
-			if string(line) == "[DONE]" {
+			if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+				log.Println("Error decoding response:", err)
+				log.Println("Response:", event.Data)
+				errChan <- err
 				return
 			}
 
-			if err := json.Unmarshal(line, &chunk); err != nil {
-				log.Println("Error decoding response:", err)
-				log.Println("Response:", string(line))
-				errChan <- err
+			// Errors after the stream started come as a chunk of their own
+			if chunk.Error != nil {
+				chunk.Error.kind = classifyAPIError(chunk.Error)
+				errChan <- chunk.Error
 				return
 			}
 
@@ -112,11 +179,73 @@ func streamOpenAI(messages []types.AiServiceMessage) (chan string, chan error) {
 				resultChan <- chunk.Choices[0].Delta.Content
 			}
 
-			if chunk.Choices[0].FinishReason != nil && *chunk.Choices[0].FinishReason == "stop" {
-				return
+			if len(chunk.Choices) > 0 && len(chunk.Choices[0].Delta.ToolCalls) > 0 {
+				toolCalls = mergeToolCallDeltas(toolCalls, chunk.Choices[0].Delta.ToolCalls)
+			}
+
+			if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason != nil {
+				finishReason = *chunk.Choices[0].FinishReason
 			}
+
+			if chunk.Usage != nil {
+				usageChan <- *chunk.Usage
+			}
+		}
+		if len(toolCalls) > 0 || finishReason == "tool_calls" {
+			toolCallChan <- toolCalls
 		}
 	}()
 
-	return resultChan, errChan
+	return resultChan, toolCallChan, usageChan, errChan
+}
+
+// postWithRetry sends a completion request. Network errors, rate limits and server
+// errors are retried with exponential backoff, or after as long as the API asks for.
+// Other error responses are returned as an *apiError right away, other errors and
+// cancelling ctx end it too.
+func postWithRetry(ctx context.Context, apiKey string, body []byte) (*http.Response, error) {
+	baseURL := os.Getenv("OPENAI_BASE_URL")
+	if baseURL == "" {
+		baseURL = openAIBaseURL
+	}
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(baseURL, "/")+"/chat/completions", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil && resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		if err == nil {
+			err = parseAPIError(resp)
+			resp.Body.Close()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt == maxRetries || !retryable(err) {
+			return nil, err
+		}
+
+		wait := delay
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			wait = min(apiErr.RetryAfter, maxRetryDelay)
+		}
+		log.Printf("Retrying in %s: %v", wait, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
 }
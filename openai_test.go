@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Serve the given responses in order, the last one for any request after that
+func fakeOpenAI(t *testing.T, responses ...func(w http.ResponseWriter)) *int {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond := responses[min(requests, len(responses)-1)]
+		requests++
+		respond(w)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	previousDelay := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = previousDelay })
+	return &requests
+}
+
+func errorResponse(status int, code string, header map[string]string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for k, v := range header {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error": {"message": "something about %s", "type": "error", "code": %q}}`, code, code)
+	}
+}
+
+func streamResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"Hello\"}, \"finish_reason\": null}]}\n\n")
+	fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {}, \"finish_reason\": \"stop\"}]}\n\n")
+	fmt.Fprint(w, "data: {\"choices\": [], \"usage\": {\"prompt_tokens\": 5, \"completion_tokens\": 1, \"total_tokens\": 6}}\n\n")
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// Collect what a stream sends
+func collectStream(t *testing.T) (string, error) {
+	resultChan, toolCallChan, _, errChan := streamOpenAI(context.Background(), completionOptions{Model: "gpt-4o"}, []types.AiServiceMessage{{Role: types.RoleUser, Content: "Hi"}}, nil)
+	content := ""
+	var streamErr error
+	for resultChan != nil || toolCallChan != nil || errChan != nil {
+		select {
+		case chunk, ok := <-resultChan:
+			if !ok {
+				resultChan = nil
+				continue
+			}
+			content += chunk
+		case _, ok := <-toolCallChan:
+			if !ok {
+				toolCallChan = nil
+			}
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			streamErr = err
+		}
+	}
+	return content, streamErr
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	requests := fakeOpenAI(t,
+		errorResponse(http.StatusTooManyRequests, "rate_limit_exceeded", map[string]string{"Retry-After": "0"}),
+		errorResponse(http.StatusBadGateway, "", nil),
+		streamResponse,
+	)
+	content, err := collectStream(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Hello" || *requests != 3 {
+		t.Fatalf("Expected the answer after two retries, got %q after %d requests", content, *requests)
+	}
+}
+
+// A recorded stream, with CRLF line endings as some proxies send them
+func TestRecordedStream(t *testing.T) {
+	recorded, err := os.ReadFile("internal/sse/testdata/openai-text.sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeOpenAI(t, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(strings.ReplaceAll(string(recorded), "\n", "\r\n")))
+	})
+	content, err := collectStream(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Hello! How can I help?" {
+		t.Fatalf("Unexpected content %q", content)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	cases := []struct {
+		status int
+		code   string
+		kind   error
+		tries  int
+	}{
+		{http.StatusUnauthorized, "invalid_api_key", errAuth, 1},
+		{http.StatusBadRequest, "context_length_exceeded", errContextLength, 1},
+		{http.StatusTooManyRequests, "insufficient_quota", errQuotaExceeded, 1},
+		{http.StatusInternalServerError, "", errServer, maxRetries + 1},
+	}
+	for _, c := range cases {
+		requests := fakeOpenAI(t, errorResponse(c.status, c.code, nil))
+		_, err := collectStream(t)
+		if !errors.Is(err, c.kind) {
+			t.Errorf("Expected %v for a %d response, got %v", c.kind, c.status, err)
+		}
+		if *requests != c.tries {
+			t.Errorf("Expected %d requests for a %d response, got %d", c.tries, c.status, *requests)
+		}
+		if err != nil && !strings.Contains(err.Error(), "something about "+c.code) {
+			t.Errorf("Expected the API's message in %q", err)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{&url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{&url.Error{Op: "Post", Err: io.ErrUnexpectedEOF}, true},
+		{&url.Error{Op: "Post", Err: errors.New("unsupported protocol scheme")}, false},
+		{&url.Error{Op: "Post", Err: context.Canceled}, false},
+		{errors.New("net/http: invalid method"), false},
+		{&apiError{kind: errRateLimited}, true},
+		{&apiError{kind: errAuth}, false},
+	}
+	for _, c := range cases {
+		if retryable(c.err) != c.retryable {
+			t.Errorf("Expected retryable(%v) to be %v", c.err, c.retryable)
+		}
+	}
+}
+
+func TestStopDuringBackoff(t *testing.T) {
+	requests := fakeOpenAI(t, errorResponse(http.StatusTooManyRequests, "rate_limit_exceeded", map[string]string{"Retry-After": "30"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := postWithRetry(ctx, "test-key", []byte("{}"))
+	if !errors.Is(err, context.Canceled) || time.Since(start) > 5*time.Second {
+		t.Fatalf("Expected to stop waiting when cancelled, got %v after %s", err, time.Since(start))
+	}
+	if *requests != 1 {
+		t.Fatalf("Expected no retry after cancelling, got %d requests", *requests)
+	}
+	// Cancelled before the first attempt, nothing is sent
+	if _, err := postWithRetry(ctx, "test-key", []byte("{}")); !errors.Is(err, context.Canceled) || *requests != 1 {
+		t.Fatalf("Expected no request with a cancelled context, got %v and %d requests", err, *requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if d := parseRetryAfter("7", now); d != 7*time.Second {
+		t.Errorf("Expected 7s, got %s", d)
+	}
+	if d := parseRetryAfter("Wed, 01 May 2024 12:00:30 GMT", now); d != 30*time.Second {
+		t.Errorf("Expected 30s, got %s", d)
+	}
+	if d := parseRetryAfter("soon", now); d != 0 {
+		t.Errorf("Expected no delay for an invalid value, got %s", d)
+	}
+}
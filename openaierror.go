@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of API errors, to check with errors.Is
+var (
+	errAuth          = errors.New("authentication failed")
+	errRateLimited   = errors.New("rate limited")
+	errQuotaExceeded = errors.New("quota exceeded")
+	errContextLength = errors.New("context length exceeded")
+	errServer        = errors.New("server error")
+	errBadRequest    = errors.New("request rejected")
+)
+
+// apiError is an error response from the API, from the status line or the body
+type apiError struct {
+	kind       error
+	StatusCode int    `json:"status_code,omitempty"`
+	Type       string `json:"type"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	// How long the API asked us to wait before retrying, zero if it didn't say
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *apiError) Unwrap() error {
+	return e.kind
+}
+
+// What went wrong and what to do about it
+func (e *apiError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	var advice string
+	switch e.kind {
+	case errAuth:
+		advice = "Check that OPENAI_API_KEY is set to a valid key with access to the model."
+	case errRateLimited:
+		advice = "Wait a moment and try again, or use a model with a higher rate limit."
+	case errQuotaExceeded:
+		advice = "Check the plan and billing details of the OpenAI account."
+	case errContextLength:
+		advice = "Remove context files or edit an earlier question to start a shorter branch."
+	case errServer:
+		advice = "The API is having problems, try again later."
+	}
+	s := fmt.Sprintf("%s: %s", e.kind, message)
+	if e.StatusCode != 0 {
+		s = fmt.Sprintf("%s (%d): %s", e.kind, e.StatusCode, message)
+	}
+	if advice != "" {
+		s += "\n" + advice
+	}
+	return s
+}
+
+// retryable tells whether trying again later may succeed: rate limits, server errors,
+// and network errors like a refused or dropped connection or a timeout. A request
+// that can't be built or was cancelled fails the same way every time.
+func retryable(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return errors.Is(err, errRateLimited) || errors.Is(err, errServer)
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// The HTTP client wraps everything in a *url.Error, look at what it wraps
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// parseAPIError reads an error response. The body is JSON like
+// {"error": {"message": "...", "type": "...", "code": "..."}}, but proxies may send
+// anything.
+func parseAPIError(resp *http.Response) *apiError {
+	var body struct {
+		Error apiError `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err := json.Unmarshal(data, &body); err != nil || body.Error.Message == "" {
+		body.Error.Message = strings.TrimSpace(string(data))
+	}
+	apiErr := &body.Error
+	apiErr.StatusCode = resp.StatusCode
+	apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	apiErr.kind = classifyAPIError(apiErr)
+	return apiErr
+}
+
+func classifyAPIError(apiErr *apiError) error {
+	switch {
+	case apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden:
+		return errAuth
+	case apiErr.Code == "insufficient_quota":
+		return errQuotaExceeded
+	case apiErr.StatusCode == http.StatusTooManyRequests:
+		return errRateLimited
+	case apiErr.Code == "context_length_exceeded":
+		return errContextLength
+	case apiErr.StatusCode >= 500 || apiErr.Type == "server_error":
+		return errServer
+	}
+	return errBadRequest
+}
+
+// Retry-After is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/worldsayshi/cir/internal/components"
+	"github.com/worldsayshi/cir/internal/plugins"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+type boundPlugin struct {
+	name   string
+	key    plugins.Key
+	plugin plugins.Plugin
+}
+
+// Keys that cir takes besides its key bindings
+var reservedKeys = map[plugins.Key]string{
+	{Key: tcell.KeyTab}:       "cycling focus",
+	{Key: tcell.KeyEnter}:     "new lines",
+	{Key: tcell.KeyBackspace}: "deleting",
+	{Key: tcell.KeyCtrlS}:     "submitting",
+	{Key: tcell.KeyCtrlC}:     "quitting",
+}
+
+// Keys the input uses for editing, from the docs of tview's TextArea
+var inputEditingKeys = map[plugins.Key]string{
+	{Key: tcell.KeyCtrlA}: "moving to the start of the line",
+	{Key: tcell.KeyCtrlE}: "moving to the end of the line",
+	{Key: tcell.KeyCtrlF}: "moving down a page",
+	{Key: tcell.KeyCtrlB}: "moving up a page",
+	{Key: tcell.KeyCtrlD}: "deleting",
+	{Key: tcell.KeyCtrlK}: "deleting to the end of the line",
+	{Key: tcell.KeyCtrlW}: "deleting a word",
+	{Key: tcell.KeyCtrlU}: "deleting the line",
+	{Key: tcell.KeyCtrlL}: "selecting all",
+	{Key: tcell.KeyCtrlQ}: "copying",
+	{Key: tcell.KeyCtrlX}: "cutting",
+	{Key: tcell.KeyCtrlV}: "pasting",
+	{Key: tcell.KeyCtrlZ}: "undoing",
+	{Key: tcell.KeyCtrlY}: "redoing",
+	altKey('b'):           "jumping to the previous word",
+	altKey('f'):           "jumping to the next word",
+}
+
+// Invalid plugins are logged and skipped, and so are plugins on a key that cir or an
+// earlier plugin takes, they would never run. A plugin may take a key the input uses
+// for editing, with a warning.
+func (cirApp *CirApplication) registerPlugins(configured map[string]plugins.Plugin) {
+	for _, name := range sortedKeys(configured) {
+		plugin := configured[name]
+		if err := plugin.Validate(); err != nil {
+			log.Printf("Skipping plugin %s: %v", name, err)
+			continue
+		}
+		key, _ := plugins.ParseShortCut(plugin.ShortCut)
+		if takenBy := cirApp.keyTakenBy(key); takenBy != "" {
+			log.Printf("Skipping plugin %s: %s is taken for %s", name, plugin.ShortCut, takenBy)
+			continue
+		}
+		if editing, ok := inputEditingKeys[key]; ok {
+			log.Printf("Plugin %s: %s is no longer %s in the input", name, plugin.ShortCut, editing)
+		}
+		cirApp.plugins = append(cirApp.plugins, boundPlugin{name: name, key: key, plugin: plugin})
+	}
+}
+
+// What a key is taken for by cir or a plugin, empty if it's free
+func (cirApp *CirApplication) keyTakenBy(key plugins.Key) string {
+	for _, binding := range cirApp.keyBindings {
+		if binding.key == key {
+			return binding.name
+		}
+	}
+	if takenBy, ok := reservedKeys[key]; ok {
+		return takenBy
+	}
+	if key.Key == tcell.KeyRune && key.Modifiers == tcell.ModAlt && key.Rune >= '1' && key.Rune <= '9' {
+		return "switching tabs"
+	}
+	for _, bp := range cirApp.plugins {
+		if bp.key == key {
+			return "plugin " + bp.name
+		}
+	}
+	return ""
+}
+
+func (cirApp *CirApplication) runPluginFor(event *tcell.EventKey) bool {
+	for _, bp := range cirApp.plugins {
+		if bp.key.Matches(event) {
+			cirApp.runPlugin(bp)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tab) pluginData() plugins.Data {
+	data := plugins.Data{
+		SessionFile: t.sessionFile,
+		Input:       t.inputArea.GetText(),
+	}
+	for _, wf := range t.workingSession.WorkingFiles {
+		data.WorkingFiles = append(data.WorkingFiles, wf.Path)
+	}
+	// The selected message, or the last one if none is selected
+	messages := t.workingSession.Messages
+	idx := components.SelectedMessage(t.chatHistory)
+	if idx < 0 || idx >= len(messages) {
+		idx = len(messages) - 1
+	}
+	if idx >= 0 {
+		msg := messages[idx]
+		data.MessageRole = msg.Role
+		data.Message = msg.Content
+		if msg.Role == types.RoleUser {
+			data.Message = msg.Question
+		}
+	}
+	return data
+}
+
+// Run the plugin in the background and apply the output on the UI goroutine
+// for the tab that was active when it started
+func (cirApp *CirApplication) runPlugin(bp boundPlugin) {
+	t := cirApp.tab
+	data := t.pluginData()
+	go func() {
+		output, err := bp.plugin.Run(data)
+		cirApp.QueueUpdateDraw(func() {
+			if err != nil {
+				log.Printf("Plugin %s failed: %v", bp.name, err)
+				cirApp.showTextModal("Plugin "+bp.name+" failed", err.Error())
+				return
+			}
+			t.applyPluginOutput(bp, output)
+		})
+	}()
+}
+
+func (t *tab) applyPluginOutput(bp boundPlugin, output string) {
+	switch bp.plugin.Output {
+	case plugins.OutputInput:
+		t.inputArea.SetText(t.inputArea.GetText()+output, true)
+	case plugins.OutputContext:
+		if strings.TrimSpace(output) == "" {
+			return
+		}
+		path := "plugin:" + bp.name
+		wfs := []types.WorkingFile{}
+		for _, wf := range t.workingSession.WorkingFiles {
+			if wf.Path != path {
+				wfs = append(wfs, wf)
+			}
+		}
+		t.setWorkingFiles(append(wfs, types.WorkingFile{Path: path, InlineContent: output}))
+	case plugins.OutputModal:
+		t.app.showTextModal(bp.name, output)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/plugins"
+)
+
+func TestPluginKeyConflicts(t *testing.T) {
+	plugin := func(shortCut string) plugins.Plugin {
+		return plugins.Plugin{ShortCut: shortCut, Scope: plugins.ScopeInput, Command: "true", Output: plugins.OutputModal}
+	}
+	config := &Config{Plugins: map[string]plugins.Plugin{
+		"context":  plugin("Ctrl-O"),
+		"stop":     plugin("Alt-X"),
+		"tab":      plugin("Alt-2"),
+		"submit":   plugin("Ctrl-S"),
+		"diff":     plugin("Ctrl-N"),
+		"diff-too": plugin("Ctrl-N"),
+		"end":      plugin("Ctrl-E"),
+	}}
+	app := NewCirApplication(&yamlStore{}, filepath.Join(t.TempDir(), "session.yaml"), config, nil)
+
+	bound := []string{}
+	for _, bp := range app.plugins {
+		bound = append(bound, bp.name)
+	}
+	// Taken keys are skipped, the input's editing keys can be taken with a warning
+	if len(bound) != 2 || bound[0] != "diff" || bound[1] != "end" {
+		t.Fatalf("Expected only the plugins on free keys to be bound, got %v", bound)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/tools"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// A provider streams completions. The channels work like those of streamOpenAI.
+type provider interface {
+	name() string
+	stream(ctx context.Context, options completionOptions, messages []types.AiServiceMessage, toolDefinitions []tools.Definition) (chan string, chan []types.ToolCall, chan types.Usage, chan error)
+}
+
+type openAI struct{}
+
+func (openAI) name() string {
+	return openAIProvider
+}
+
+func (openAI) stream(ctx context.Context, options completionOptions, messages []types.AiServiceMessage, toolDefinitions []tools.Definition) (chan string, chan []types.ToolCall, chan types.Usage, chan error) {
+	return streamOpenAI(ctx, options, messages, toolDefinitions)
+}
+
+// newProvider gives OpenAI, or with a cassette in the config, a provider that records
+// OpenAI's answers to it or replays them from it
+func newProvider(config *Config) (provider, error) {
+	cassette := config.Cassette
+	if cassette.Path == "" {
+		return openAI{}, nil
+	}
+	switch cassette.Mode {
+	case cassetteRecord:
+		return newRecorder(openAI{}, cassette.Path), nil
+	case cassetteReplay, "":
+		return loadReplayer(cassette.Path)
+	}
+	return nil, fmt.Errorf("unknown cassette mode %q, use %s or %s", cassette.Mode, cassetteRecord, cassetteReplay)
+}
+
+// One thing sent by a stream, as recorded in a cassette or scripted in a test. Exactly
+// one of the content fields is set.
+type streamEvent struct {
+	// How long to wait before sending
+	Delay     time.Duration    `json:"delay,omitempty"`
+	Chunk     string           `json:"chunk,omitempty"`
+	ToolCalls []types.ToolCall `json:"tool_calls,omitempty"`
+	Usage     *types.Usage     `json:"usage,omitempty"`
+	// An error response from the API, which is classified again when replayed
+	APIError *apiError `json:"api_error,omitempty"`
+	// Any other error
+	Error string `json:"error,omitempty"`
+	// Scripted errors keep their type
+	err error
+}
+
+func (event streamEvent) error() error {
+	switch {
+	case event.err != nil:
+		return event.err
+	case event.APIError != nil:
+		apiErr := *event.APIError
+		apiErr.kind = classifyAPIError(&apiErr)
+		return &apiErr
+	case event.Error != "":
+		return errors.New(event.Error)
+	}
+	return nil
+}
+
+// playEvents streams the events like streamOpenAI streams an answer. An error event
+// ends the stream, and so does cancelling ctx.
+func playEvents(ctx context.Context, events []streamEvent) (chan string, chan []types.ToolCall, chan types.Usage, chan error) {
+	resultChan := make(chan string)
+	toolCallChan := make(chan []types.ToolCall)
+	usageChan := make(chan types.Usage, 1)
+	errChan := make(chan error)
+
+	go func() {
+		defer close(resultChan)
+		defer close(toolCallChan)
+		defer close(errChan)
+
+		for _, event := range events {
+			select {
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			case <-time.After(event.Delay):
+			}
+			switch {
+			case event.error() != nil:
+				errChan <- event.error()
+				return
+			case event.Usage != nil:
+				select {
+				case usageChan <- *event.Usage:
+				default:
+				}
+			case event.ToolCalls != nil:
+				toolCallChan <- event.ToolCalls
+			default:
+				resultChan <- event.Chunk
+			}
+		}
+	}()
+
+	return resultChan, toolCallChan, usageChan, errChan
+}
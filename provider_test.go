@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/tools"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+const scriptedProvider = "scripted"
+
+// scripted is a fake provider that plays a script of events for each completion, the
+// last script for any completion after that. The messages of each request are kept.
+type scripted struct {
+	scripts  [][]streamEvent
+	mutex    sync.Mutex
+	requests [][]types.AiServiceMessage
+}
+
+func newScripted(scripts ...[]streamEvent) *scripted {
+	return &scripted{scripts: scripts}
+}
+
+func (p *scripted) name() string {
+	return scriptedProvider
+}
+
+func (p *scripted) stream(ctx context.Context, options completionOptions, messages []types.AiServiceMessage, toolDefinitions []tools.Definition) (chan string, chan []types.ToolCall, chan types.Usage, chan error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	script := p.scripts[min(len(p.requests), len(p.scripts)-1)]
+	p.requests = append(p.requests, messages)
+	return playEvents(ctx, script)
+}
+
+// A script that streams the chunks and then the usage
+func chunks(contents ...string) []streamEvent {
+	events := []streamEvent{}
+	for _, content := range contents {
+		events = append(events, streamEvent{Chunk: content})
+	}
+	return append(events, streamEvent{Usage: &types.Usage{PromptTokens: 10, CompletionTokens: len(contents), TotalTokens: 10 + len(contents)}})
+}
+
+func TestPlayEventsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	resultChan, _, _, errChan := playEvents(ctx, []streamEvent{{Chunk: "Hel"}, {Delay: time.Hour, Chunk: "lo"}})
+	if chunk := <-resultChan; chunk != "Hel" {
+		t.Fatalf("Expected the first chunk, got %q", chunk)
+	}
+	cancel()
+	if err := <-errChan; err != context.Canceled {
+		t.Fatalf("Expected the stream to be cancelled, got %v", err)
+	}
+	if _, ok := <-resultChan; ok {
+		t.Fatalf("Expected the stream to be closed")
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/worldsayshi/cir/internal/redact"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// Mask secrets in the question and in the files about to be sent, except allowed files
+func redactSecrets(redactor *redact.Redactor, question string, filesToSubmit []types.WorkingFile) (string, []types.WorkingFile, []redact.Finding) {
+	findings := []redact.Finding{}
+
+	question, found := redactor.Redact(question)
+	if len(found) > 0 {
+		findings = append(findings, redact.Finding{Source: "question", Kinds: found})
+	}
+
+	redactedFiles := []types.WorkingFile{}
+	for _, wf := range filesToSubmit {
+		if !redactor.Allowed(wf.Path) {
+			var content string
+			content, found = redactor.Redact(string(wf.FileContent))
+			if len(found) > 0 {
+				wf.FileContent = []byte(content)
+				findings = append(findings, redact.Finding{Source: wf.Path, Kinds: found})
+			}
+		}
+		redactedFiles = append(redactedFiles, wf)
+	}
+	return question, redactedFiles, findings
+}
+
+// Mask secrets in what a tool returns before it goes back to the model. A file read
+// by read_file is sent as is if it's allowed. Anything else, like grep matches or what
+// an MCP tool returns, can come from any file and is always redacted.
+func redactToolResult(redactor *redact.Redactor, call types.ToolCall, result string) (string, []redact.Finding) {
+	if call.Function.Name == "read_file" {
+		var args struct {
+			Path string `json:"path"`
+		}
+		if json.Unmarshal([]byte(call.Function.Arguments), &args) == nil && args.Path != "" && redactor.Allowed(args.Path) {
+			return result, nil
+		}
+	}
+	result, found := redactor.Redact(result)
+	if len(found) == 0 {
+		return result, nil
+	}
+	return result, []redact.Finding{{Source: call.Function.Name + " " + call.Function.Arguments, Kinds: found}}
+}
+
+func formatFindings(findings []redact.Finding) string {
+	lines := []string{"These secrets were masked before sending:", ""}
+	for _, f := range findings {
+		lines = append(lines, f.String())
+	}
+	lines = append(lines, "", "To send a file as is, add it to redaction.allow_files in the config.")
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/worldsayshi/cir/internal/components"
+)
+
+func parseTemperature(s string) (*float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	temperature, err := strconv.ParseFloat(s, 64)
+	if err != nil || temperature < 0 || temperature > 2 {
+		return nil, fmt.Errorf("temperature must be a number between 0 and 2, got %q", s)
+	}
+	return &temperature, nil
+}
+
+func (t *tab) openRegenerateDialog() {
+	if t.streaming() {
+		return
+	}
+	app := t.app
+	initial := components.RegenerateSettings{Model: t.model(), Keep: true}
+	dialog := components.NewRegenerateDialog(initial, func(settings components.RegenerateSettings, ok bool) {
+		app.pages.RemovePage("regenerate")
+		app.SetFocus(t.inputArea)
+		if !ok {
+			return
+		}
+		temperature, err := parseTemperature(settings.Temperature)
+		if err != nil {
+			app.showTextModal("Error", err.Error())
+			return
+		}
+		options := completionOptions{Model: strings.TrimSpace(settings.Model), Temperature: temperature}
+		if options.Model == "" {
+			options.Model = t.model()
+		}
+		t.checkSpending(func() {
+			if err := t.regenerate(settings.Keep); err != nil {
+				app.showTextModal("Error", err.Error())
+				return
+			}
+			t.streamInBackground(options)
+		})
+	})
+	app.pages.AddPage("regenerate", components.Centered(dialog, 60, 11), true, true)
+	app.SetFocus(dialog)
+}
+
+// runRegenerate implements `cir regenerate`: stream the last answer again to stdout
+func runRegenerate(cirDir string, defaultSessionFile string, defaultConfigFile string, args []string) error {
+	flags := flag.NewFlagSet("regenerate", flag.ExitOnError)
+	session := flags.String("session", defaultSessionFile, "session name or path")
+	configFile := flags.String("config", defaultConfigFile, "path to the config file")
+	model := flags.String("model", "", "model to use, defaults to the session's model")
+	temperatureFlag := flags.String("temperature", "", "sampling temperature, defaults to the API's")
+	discard := flags.Bool("discard", false, "discard the old answer instead of keeping it as an alternative")
+	flags.Parse(args)
+
+	temperature, err := parseTemperature(*temperatureFlag)
+	if err != nil {
+		return err
+	}
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	store, err := openSessionStore(cirDir, config)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	mcpClients := startMCPServers(config.MCPServers)
+	defer closeMCPClients(mcpClients)
+	c, err := newChat(store, resolveSessionFile(cirDir, *session), config, mcpClients, newSpendTracker(cirDir, config.Spending))
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	if err := c.spend.checkHeadless(c.sessionFile, os.Stderr); err != nil {
+		return err
+	}
+
+	options := completionOptions{Model: *model, Temperature: temperature}
+	if options.Model == "" {
+		options.Model = c.model()
+	}
+	if err := c.regenerate(!*discard); err != nil {
+		return err
+	}
+	log.Printf("Regenerating with %s", options.Model)
+	return printAnswer(c, options)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func TestRegenerate(t *testing.T) {
+	sessionFile := filepath.Join(t.TempDir(), "session.yaml")
+	session := &types.WorkingSession{
+		Messages: []types.Message{
+			{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser, Content: "Hello"}, Question: "Hello"},
+			{AiServiceMessage: types.AiServiceMessage{Role: types.RoleAssistant, ToolCalls: []types.ToolCall{{ID: "1"}}}},
+			{AiServiceMessage: types.AiServiceMessage{Role: types.RoleTool, Content: "result", ToolCallID: "1"}},
+			{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem, Content: "Hi"}},
+		},
+	}
+	if err := saveWorkingSession(sessionFile, session); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newChat(&yamlStore{}, sessionFile, &Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The whole answer, tool calls included, is regenerated
+	if err := c.regenerate(true); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.workingSession.Messages) != 1 || len(c.workingSession.Tree) != 4 {
+		t.Fatalf("Expected the old answer to be kept aside, got %d messages in the branch and %d in the tree",
+			len(c.workingSession.Messages), len(c.workingSession.Tree))
+	}
+
+	c.workingSession.Messages = append(c.workingSession.Messages,
+		types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem, Content: "Hello there"}})
+	if siblings, _ := c.workingSession.Siblings(1); len(siblings) != 1 {
+		t.Fatalf("Expected the new answer to be unsaved, got %d siblings", len(siblings))
+	}
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+	if siblings, pos := c.workingSession.Siblings(1); len(siblings) != 2 || pos != 1 {
+		t.Fatalf("Expected the new answer to be an alternative to the old one")
+	}
+
+	// Without keep the old answer is gone
+	if err := c.regenerate(false); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.workingSession.Tree) != 4 {
+		t.Fatalf("Expected the regenerated answer to be discarded, got %d messages in the tree", len(c.workingSession.Tree))
+	}
+
+	c.workingSession.Fork(0)
+	if err := c.regenerate(true); err == nil {
+		t.Fatalf("Expected an error when there is no answer")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/worldsayshi/cir/internal/components"
+	"github.com/worldsayshi/cir/internal/search"
+	"github.com/worldsayshi/cir/internal/state"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+const (
+	searchIndexFileName = "search-index.json"
+	maxSearchResults    = 100
+)
+
+// searchSessions searches every session in the cir dir. With persist the index is
+// kept in the cir dir so unchanged sessions aren't read again.
+func searchSessions(cirDir string, query string, persist bool, limit int) ([]search.Result, error) {
+	indexFile := ""
+	if persist {
+		indexFile = filepath.Join(cirDir, searchIndexFileName)
+	}
+	index := search.Open(indexFile)
+	sessionFiles, err := sessionPaths(cirDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := index.Refresh(sessionFiles); err != nil {
+		return nil, err
+	}
+	return index.Search(query, limit), nil
+}
+
+// runSearch implements `cir search`
+func runSearch(cirDir string, defaultConfigFile string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	flags.SetOutput(out)
+	configFile := flags.String("config", defaultConfigFile, "path to the config file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: cir search [-config file] <words...>")
+	}
+	config, err := loadConfig(*configFile)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	store, err := openSessionStore(cirDir, config)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	results, err := store.Search(strings.Join(flags.Args(), " "), maxSearchResults)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SESSION\tMESSAGE\tROLE\tSNIPPET")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", sessionName(r.SessionFile), r.MessageID, r.Role, r.Snippet)
+	}
+	return tw.Flush()
+}
+
+func (cirApp *CirApplication) openSearch() {
+	var results []search.Result
+	closeSearch := func() {
+		cirApp.pages.RemovePage("search")
+		cirApp.SetFocus(cirApp.inputArea)
+	}
+	view := components.NewSearchView(cirApp.Application,
+		func(query string) []components.SearchResult {
+			var err error
+			results, err = cirApp.store.Search(query, maxSearchResults)
+			if err != nil {
+				log.Println("Error searching sessions:", err)
+				cirApp.showTextModal("Error", err.Error())
+			}
+			items := []components.SearchResult{}
+			for _, r := range results {
+				items = append(items, components.SearchResult{Session: sessionName(r.SessionFile), Role: r.Role, Snippet: r.Snippet})
+			}
+			return items
+		},
+		func(i int) {
+			closeSearch()
+			if err := cirApp.openMessage(results[i].SessionFile, results[i].MessageID); err != nil {
+				cirApp.showTextModal("Error", err.Error())
+			}
+		},
+		closeSearch,
+	)
+	cirApp.pages.AddPage("search", components.Centered(view, 120, 30), true, true)
+	cirApp.SetFocus(view)
+}
+
+// Open a session in a tab with the branch through the message checked out and
+// the message selected
+func (cirApp *CirApplication) openMessage(sessionFile string, messageID int) error {
+	if err := cirApp.openTab(sessionFile); err != nil {
+		return err
+	}
+	if cirApp.streaming() {
+		return nil
+	}
+	idx := messageIndex(cirApp.workingSession.Messages, messageID)
+	if idx < 0 {
+		cirApp.state.Dispatch(state.CheckedOut{MessageID: messageID})
+		cirApp.saveSession()
+		idx = messageIndex(cirApp.workingSession.Messages, messageID)
+	}
+	components.SelectMessage(cirApp.chatHistory, idx)
+	cirApp.SetFocus(cirApp.chatHistory)
+	return nil
+}
+
+func messageIndex(messages []types.Message, id int) int {
+	for i, msg := range messages {
+		if msg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
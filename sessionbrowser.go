@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/worldsayshi/cir/internal/components"
+	"github.com/worldsayshi/cir/internal/export"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func (cirApp *CirApplication) sessionItems() []components.SessionItem {
+	sessions, err := cirApp.store.List()
+	if err != nil {
+		log.Println("Error listing sessions:", err)
+	}
+	items := []components.SessionItem{}
+	for _, s := range sessions {
+		items = append(items, components.SessionItem{
+			Name:         s.Name,
+			Path:         s.Path,
+			Title:        s.Title,
+			ModTime:      s.ModTime,
+			MessageCount: s.MessageCount,
+			Model:        s.Model,
+		})
+	}
+	return items
+}
+
+// Switch the TUI to another session file, creating it if it doesn't exist
+func (cirApp *CirApplication) switchSession(sessionFile string) error {
+	if i := cirApp.tabIndexOf(sessionFile); i >= 0 {
+		cirApp.activateTab(i)
+		return nil
+	}
+	if cirApp.streaming() {
+		return fmt.Errorf("wait for the answer to finish before switching sessions")
+	}
+	if err := cirApp.save(); err != nil {
+		return err
+	}
+	if err := cirApp.switchTo(sessionFile, true); err != nil {
+		return err
+	}
+	cirApp.renderSession()
+	return nil
+}
+
+// A session renamed or copied to a name is kept next to the one it came from
+func renamedSessionFile(sessionFile string, name string) string {
+	return resolveSessionFile(filepath.Dir(sessionFile), name)
+}
+
+func (cirApp *CirApplication) openSessionBrowser() {
+	var browser *components.SessionBrowser
+	closeBrowser := func() {
+		cirApp.pages.RemovePage("sessions")
+		cirApp.SetFocus(cirApp.inputArea)
+	}
+	// Run a session operation, then refresh the list or show what went wrong
+	refresh := func(err error) {
+		if err != nil {
+			cirApp.showTextModal("Error", err.Error())
+			return
+		}
+		browser.SetItems(cirApp.sessionItems())
+		cirApp.SetFocus(browser)
+	}
+	// Ask for a session name in a dialog on top of the browser
+	askName := func(title string, initial string, done func(name string) error) {
+		dialog := components.NewPromptDialog(title, "Name", initial, func(name string, ok bool) {
+			cirApp.pages.RemovePage("prompt")
+			cirApp.SetFocus(browser)
+			if ok && name != "" {
+				refresh(done(name))
+			}
+		})
+		cirApp.pages.AddPage("prompt", components.Centered(dialog, 60, 7), true, true)
+		cirApp.SetFocus(dialog)
+	}
+
+	browser = components.NewSessionBrowser(cirApp.Application, cirApp.sessionItems(), components.SessionBrowserHandlers{
+		Open: func(item components.SessionItem) {
+			if err := cirApp.switchSession(item.Path); err != nil {
+				cirApp.showTextModal("Error", err.Error())
+				return
+			}
+			closeBrowser()
+		},
+		Create: func() {
+			askName("New session", "", func(name string) error {
+				sessionFile := resolveSessionFile(cirApp.sessionsDir, name)
+				if err := checkNewSessionName(cirApp.store, sessionFile); err != nil {
+					return err
+				}
+				if err := cirApp.store.Save(sessionFile, &types.WorkingSession{}); err != nil {
+					return err
+				}
+				return cirApp.switchSession(sessionFile)
+			})
+		},
+		Rename: func(item components.SessionItem) {
+			askName("Rename session", sessionName(item.Path), func(newName string) error {
+				dst := renamedSessionFile(item.Path, newName)
+				i := cirApp.tabIndexOf(item.Path)
+				if i < 0 {
+					// Not ours, but it may be open in another cir
+					return withSessionLocks([]string{item.Path, dst}, func() error {
+						return renameSession(cirApp.store, item.Path, dst)
+					})
+				}
+				// The tab holds the lock of the source, and takes the destination's next
+				err := withSessionLock(dst, func() error {
+					return renameSession(cirApp.store, item.Path, dst)
+				})
+				if err != nil {
+					return err
+				}
+				if err := cirApp.tabs[i].switchTo(dst, false); err != nil {
+					return err
+				}
+				cirApp.renderTabBar()
+				return nil
+			})
+		},
+		Duplicate: func(item components.SessionItem) {
+			askName("Duplicate session", sessionName(item.Path)+"-copy", func(newName string) error {
+				dst := renamedSessionFile(item.Path, newName)
+				if cirApp.tabIndexOf(item.Path) >= 0 {
+					return withSessionLock(dst, func() error {
+						return copySession(cirApp.store, item.Path, dst)
+					})
+				}
+				return withSessionLocks([]string{item.Path, dst}, func() error {
+					return copySession(cirApp.store, item.Path, dst)
+				})
+			})
+		},
+		Delete: func(item components.SessionItem) {
+			if cirApp.tabIndexOf(item.Path) >= 0 {
+				cirApp.showTextModal("Error", "Can't delete a session that is open in a tab, close it first")
+				return
+			}
+			cirApp.confirm(fmt.Sprintf("Delete session %s?", item.Name), func() {
+				refresh(withSessionLock(item.Path, func() error {
+					return removeSession(cirApp.store, item.Path)
+				}))
+			})
+		},
+		Export: func(item components.SessionItem) {
+			askPath := components.NewPromptDialog("Export session (.md, .html or .json)", "File", sessionName(item.Path)+".md", func(path string, ok bool) {
+				cirApp.pages.RemovePage("prompt")
+				cirApp.SetFocus(browser)
+				if !ok || path == "" {
+					return
+				}
+				if err := exportSession(cirApp.store, item.Path, path); err != nil {
+					cirApp.showTextModal("Error", err.Error())
+					return
+				}
+				cirApp.showTextModal("Exported", "Wrote "+path)
+			})
+			cirApp.pages.AddPage("prompt", components.Centered(askPath, 60, 7), true, true)
+			cirApp.SetFocus(askPath)
+		},
+		Close: closeBrowser,
+	})
+	cirApp.pages.AddPage("sessions", components.Centered(browser, 120, 30), true, true)
+	cirApp.SetFocus(browser)
+}
+
+// Export a session to a file, in the format given by its extension
+func exportSession(store SessionStore, sessionFile string, path string) error {
+	exportFunc, err := export.FormatForPath(path)
+	if err != nil {
+		return err
+	}
+	workingSession, err := loadExistingSession(store, sessionFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := exportFunc(f, sessionName(sessionFile), workingSession); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
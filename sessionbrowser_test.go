@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/components"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func TestSessionItemsOutsideCirDir(t *testing.T) {
+	cirDir := t.TempDir()
+	store, err := openSQLiteStore(cirDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	elsewhere := filepath.Join(t.TempDir(), "notes.yaml")
+	if err := store.Save(elsewhere, &types.WorkingSession{}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := NewCirApplication(store, filepath.Join(cirDir, "default.yaml"), &Config{}, nil)
+	defer app.close()
+	var item components.SessionItem
+	for _, i := range app.sessionItems() {
+		if i.Name == elsewhere {
+			item = i
+		}
+	}
+	if item.Path != elsewhere {
+		t.Fatalf("Expected the browser to act on %s, got %q", elsewhere, item.Path)
+	}
+	if dst := renamedSessionFile(item.Path, "renamed"); dst != filepath.Join(filepath.Dir(elsewhere), "renamed.yaml") {
+		t.Fatalf("Expected the session to be renamed next to where it was, got %s", dst)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+const configFileName = "config.yaml"
+
+type sessionInfo struct {
+	Name         string
+	Path         string
+	Title        string
+	ModTime      time.Time
+	MessageCount int
+	Model        string
+}
+
+func sessionModel(workingSession *types.WorkingSession) string {
+	if workingSession.Model != "" {
+		return workingSession.Model
+	}
+	return defaultModel
+}
+
+// A name without a slash or extension refers to a session in the cir dir
+func resolveSessionFile(cirDir string, name string) string {
+	if strings.ContainsRune(name, filepath.Separator) || filepath.Ext(name) != "" {
+		return name
+	}
+	return filepath.Join(cirDir, name+".yaml")
+}
+
+// Stores may give the path of a session in another form than it was opened with
+func samePath(a string, b string) bool {
+	return absSessionPath(a) == absSessionPath(b)
+}
+
+// The same session is always given the same key, whichever form its path was given in
+func absSessionPath(sessionFile string) string {
+	path, err := filepath.Abs(sessionFile)
+	if err != nil {
+		return filepath.Clean(sessionFile)
+	}
+	return path
+}
+
+func sessionName(sessionFile string) string {
+	return strings.TrimSuffix(filepath.Base(sessionFile), filepath.Ext(sessionFile))
+}
+
+// The first question, shortened, is the title of a session
+func sessionTitle(workingSession *types.WorkingSession) string {
+	for _, msg := range workingSession.Messages {
+		if msg.Role == types.RoleUser && msg.Question != "" {
+			title := strings.Join(strings.Fields(msg.Question), " ")
+			if len(title) > 60 {
+				title = title[:57] + "..."
+			}
+			return title
+		}
+	}
+	return "(empty)"
+}
+
+// The files in the cir dir that may be sessions
+func sessionPaths(cirDir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(cirDir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sessionPaths := []string{}
+	for _, p := range paths {
+		if filepath.Base(p) != configFileName {
+			sessionPaths = append(sessionPaths, p)
+		}
+	}
+	return sessionPaths, nil
+}
+
+// listSessions lists the session files in the cir dir, most recently modified first
+func listSessions(cirDir string) ([]sessionInfo, error) {
+	paths, err := sessionPaths(cirDir)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []sessionInfo{}
+	for _, p := range paths {
+		stat, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		workingSession, err := types.UnmarshalWorkingSession(data)
+		if err != nil {
+			// Not a session file
+			continue
+		}
+		sessions = append(sessions, sessionInfo{
+			Name:         sessionName(p),
+			Path:         p,
+			Title:        sessionTitle(workingSession),
+			ModTime:      stat.ModTime(),
+			MessageCount: len(workingSession.Messages),
+			Model:        sessionModel(workingSession),
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ModTime.After(sessions[j].ModTime)
+	})
+	return sessions, nil
+}
+
+// Unlike Load, don't create the session if it's missing
+func loadExistingSession(store SessionStore, sessionFile string) (*types.WorkingSession, error) {
+	if err := checkSessionExists(store, sessionFile); err != nil {
+		return nil, err
+	}
+	return store.Load(sessionFile)
+}
+
+func checkSessionExists(store SessionStore, sessionFile string) error {
+	version, err := store.Version(sessionFile)
+	if err != nil {
+		return err
+	}
+	if version == "" {
+		return fmt.Errorf("no session at %s", sessionFile)
+	}
+	return nil
+}
+
+func checkNewSessionName(store SessionStore, sessionFile string) error {
+	version, err := store.Version(sessionFile)
+	if err != nil {
+		return err
+	}
+	if version != "" {
+		return fmt.Errorf("a session already exists at %s", sessionFile)
+	}
+	return nil
+}
+
+func checkSessionCopy(store SessionStore, src string, dst string) error {
+	if err := checkSessionExists(store, src); err != nil {
+		return err
+	}
+	return checkNewSessionName(store, dst)
+}
+
+func removeSession(store SessionStore, sessionFile string) error {
+	if err := checkSessionExists(store, sessionFile); err != nil {
+		return err
+	}
+	return store.Remove(sessionFile)
+}
+
+func renameSession(store SessionStore, src string, dst string) error {
+	if err := copySession(store, src, dst); err != nil {
+		return err
+	}
+	return store.Remove(src)
+}
+
+func copySession(store SessionStore, src string, dst string) error {
+	if err := checkSessionCopy(store, src, dst); err != nil {
+		return err
+	}
+	workingSession, err := store.Load(src)
+	if err != nil {
+		return err
+	}
+	return store.Save(dst, workingSession)
+}
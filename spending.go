@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/cost"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+const spendingFileName = "spending.jsonl"
+
+// spendTracker records what answers cost and checks the spending limits. Spending is
+// counted per session, per day and per project, which is the directory cir runs in.
+// Sessions are told apart by their absolute path, so sessions with the same name in
+// different directories don't share a total. A nil tracker tracks nothing.
+type spendTracker struct {
+	ledger  *cost.Ledger
+	prices  cost.Prices
+	limits  cost.Limits
+	project string
+}
+
+func newSpendTracker(cirDir string, config cost.Config) *spendTracker {
+	project, err := os.Getwd()
+	if err != nil {
+		log.Println("Error getting the project directory:", err)
+	}
+	return &spendTracker{
+		ledger:  cost.OpenLedger(filepath.Join(cirDir, spendingFileName)),
+		prices:  cost.DefaultPrices.With(config.Prices),
+		limits:  config.Limits,
+		project: project,
+	}
+}
+
+// record adds the cost of an answer to the ledger. Answers without usage can't be priced.
+func (s *spendTracker) record(sessionFile string, answer types.Message) {
+	if s == nil || answer.Usage == nil {
+		return
+	}
+	amount, ok := s.prices.Cost(answer.Model, *answer.Usage)
+	if !ok {
+		log.Printf("No price for model %s, add it to the config to track its cost", answer.Model)
+	}
+	err := s.ledger.Add(cost.Entry{
+		Time:             time.Now(),
+		Session:          absSessionPath(sessionFile),
+		Project:          s.project,
+		Model:            answer.Model,
+		PromptTokens:     answer.Usage.PromptTokens,
+		CompletionTokens: answer.Usage.CompletionTokens,
+		Cost:             amount,
+	})
+	if err != nil {
+		log.Println("Error recording spending:", err)
+	}
+}
+
+func (s *spendTracker) totals(sessionFile string) (cost.Totals, error) {
+	if s == nil {
+		return cost.Totals{}, nil
+	}
+	return s.ledger.Totals(absSessionPath(sessionFile), s.project, time.Now())
+}
+
+// check gives a warning for each soft limit that was reached, and an error if a hard
+// limit was reached
+func (s *spendTracker) check(sessionFile string) ([]string, error) {
+	if s == nil {
+		return nil, nil
+	}
+	totals, err := s.totals(sessionFile)
+	if err != nil {
+		// Better to let the question through than to block on a broken ledger
+		log.Println("Error reading spending:", err)
+		return nil, nil
+	}
+	return s.limits.Check(totals)
+}
+
+// checkHeadless is check for the command line, warnings are printed to w
+func (s *spendTracker) checkHeadless(sessionFile string, w io.Writer) error {
+	warnings, err := s.check(sessionFile)
+	for _, warning := range warnings {
+		fmt.Fprintln(w, "Warning:", warning)
+	}
+	return err
+}
+
+// The running cost for the status bar
+func (s *spendTracker) status(sessionFile string) string {
+	totals, err := s.totals(sessionFile)
+	if err != nil {
+		log.Println("Error reading spending:", err)
+		return ""
+	}
+	return fmt.Sprintf("Session %s · Today %s · Project %s",
+		cost.Format(totals.Session), cost.Format(totals.Daily), cost.Format(totals.Project))
+}
+
+func (cirApp *CirApplication) renderStatusBar() {
+	text := cirApp.spend.status(cirApp.sessionFile)
+	if warnings, err := cirApp.spend.check(cirApp.sessionFile); err != nil {
+		text = "[red]" + text + "[-]"
+	} else if len(warnings) > 0 {
+		text = "[yellow]" + text + "[-]"
+	}
+	cirApp.statusBar.SetText(text)
+}
+
+// checkSpending runs submit unless a hard spending limit was reached. Reached soft
+// limits are confirmed first.
+func (t *tab) checkSpending(submit func()) {
+	warnings, err := t.app.spend.check(t.sessionFile)
+	if err != nil {
+		t.app.showTextModal("Spending limit", err.Error()+"\n\nRaise the limit in the config file to submit more.")
+		return
+	}
+	if len(warnings) > 0 {
+		t.app.confirm(strings.Join(warnings, "\n")+"\n\nSubmit anyway?", submit)
+		return
+	}
+	submit()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/worldsayshi/cir/internal/cost"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func TestSpendingLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+	sessionFile := filepath.Join(tmpDir, "session.yaml")
+	spend := newSpendTracker(tmpDir, cost.Config{
+		Prices: cost.Prices{"test-model": {Input: 1, Output: 2}},
+		Limits: cost.Limits{Session: cost.Limit{Soft: 0.5, Hard: 1}},
+	})
+	app := NewCirApplication(&yamlStore{}, sessionFile, &Config{}, spend)
+
+	answer := types.Message{Model: "test-model", Usage: &types.Usage{PromptTokens: 200_000, CompletionTokens: 200_000}}
+	spend.record(sessionFile, answer)
+	app.renderStatusBar()
+	if status := app.statusBar.GetText(true); !strings.Contains(status, "Session $0.6000") {
+		t.Fatalf("Expected the session cost in the status bar, got %q", status)
+	}
+	if warnings, err := spend.check(sessionFile); err != nil || len(warnings) != 1 {
+		t.Fatalf("Expected a soft limit warning, got %v, %v", warnings, err)
+	}
+
+	spend.record(sessionFile, answer)
+	app.handleChatSubmit("One more question")
+	if len(app.workingSession.Messages) != 0 {
+		t.Fatalf("Expected the hard limit to refuse the question")
+	}
+	// Other sessions are only held back by their own limit
+	if _, err := spend.check(filepath.Join(tmpDir, "other.yaml")); err != nil {
+		t.Fatalf("Expected another session to be under its limit, got %v", err)
+	}
+}
+
+func TestSpendingPerSessionPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	spend := newSpendTracker(tmpDir, cost.Config{
+		Prices: cost.Prices{"test-model": {Input: 1, Output: 2}},
+		Limits: cost.Limits{Session: cost.Limit{Hard: 0.5}},
+	})
+	sessionFile := filepath.Join(tmpDir, "a", "notes.yaml")
+	spend.record(sessionFile, types.Message{Model: "test-model", Usage: &types.Usage{PromptTokens: 200_000, CompletionTokens: 200_000}})
+
+	// A session with the same name in another directory has its own total
+	if _, err := spend.check(filepath.Join(tmpDir, "b", "notes.yaml")); err != nil {
+		t.Fatalf("Expected a session with the same name elsewhere to be under its limit, got %v", err)
+	}
+	// The same session given by a relative path shares the total
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	relative, err := filepath.Rel(wd, sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spend.check(relative); err == nil {
+		t.Fatalf("Expected the relative path to reach the limit of the session")
+	}
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/worldsayshi/cir/internal/search"
+	"github.com/worldsayshi/cir/internal/types"
+	"gopkg.in/yaml.v2"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteFileName = "sessions.db"
+
+// Messages are rows of their own so that saving a long session only writes the
+// messages that changed. The search column holds the lower cased searchable text.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	path TEXT PRIMARY KEY,
+	version INTEGER NOT NULL,
+	modified INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	message_count INTEGER NOT NULL,
+	model TEXT NOT NULL,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS messages (
+	session TEXT NOT NULL REFERENCES sessions(path) ON DELETE CASCADE,
+	id INTEGER NOT NULL,
+	role TEXT NOT NULL,
+	search TEXT,
+	hash TEXT NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (session, id)
+);
+`
+
+// The schema version kept in the user_version pragma. Sessions were keyed by the
+// name part of their path before version 1.
+const sqliteSchemaVersion = 1
+
+// sqliteStore keeps all sessions in one SQLite database in the cir dir. Sessions are
+// keyed by their absolute path, as they are locked by it.
+type sqliteStore struct {
+	db  *sql.DB
+	dir string
+	// The message hashes of each session as of a version, so that saving doesn't
+	// have to read them back
+	mutex  sync.Mutex
+	hashes map[string]*storedHashes
+}
+
+type storedHashes struct {
+	version int64
+	hashes  map[int]string
+}
+
+func openSQLiteStore(cirDir string) (*sqliteStore, error) {
+	path := filepath.Join(cirDir, sqliteFileName)
+	// Other cir processes may write sessions of their own at the same time
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer anyway, and this keeps the pragmas on one connection
+	db.SetMaxOpenConns(1)
+	if err := migrateSQLite(db, cirDir); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	return &sqliteStore{db: db, dir: cirDir, hashes: map[string]*storedHashes{}}, nil
+}
+
+// migrateSQLite creates the schema, or brings a database of an older cir up to date
+func migrateSQLite(db *sql.DB, cirDir string) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version >= sqliteSchemaVersion {
+		return nil
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'sessions'`).Scan(&tables); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if tables > 0 {
+		if err := keySessionsByPath(tx, cirDir); err != nil {
+			return err
+		}
+	} else if _, err := tx.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, sqliteSchemaVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Sessions named by the name part of their path are in the cir dir, as the store
+// couldn't tell apart others of the same name
+func keySessionsByPath(tx *sql.Tx, cirDir string) error {
+	dir, err := filepath.Abs(cirDir)
+	if err != nil {
+		return err
+	}
+	// The messages are moved along with their session below
+	if _, err := tx.Exec(`PRAGMA defer_foreign_keys = ON`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`ALTER TABLE sessions RENAME COLUMN name TO path`); err != nil {
+		return err
+	}
+	rows, err := tx.Query(`SELECT path FROM sessions`)
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name+".yaml")
+		if _, err := tx.Exec(`UPDATE sessions SET path = ? WHERE path = ?`, path, name); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE messages SET session = ? WHERE session = ?`, path, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The key of a session in the database
+func (store *sqliteStore) Load(sessionFile string) (*types.WorkingSession, error) {
+	key := absSessionPath(sessionFile)
+	var data string
+	err := store.db.QueryRow(`SELECT data FROM sessions WHERE path = ?`, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		workingSession := &types.WorkingSession{}
+		return workingSession, store.Save(sessionFile, workingSession)
+	}
+	if err != nil {
+		return nil, err
+	}
+	workingSession, err := types.UnmarshalWorkingSession([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := store.db.Query(`SELECT data FROM messages WHERE session = ? ORDER BY id`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	workingSession.Tree = []types.Message{}
+	for rows.Next() {
+		var msg types.Message
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal([]byte(data), &msg); err != nil {
+			return nil, err
+		}
+		workingSession.Tree = append(workingSession.Tree, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	workingSession.Messages = workingSession.Branch(workingSession.Head)
+	return workingSession, nil
+}
+
+// Save writes the session settings and the messages that are new or changed since
+// the last save, and deletes the messages that were removed from the tree
+func (store *sqliteStore) Save(sessionFile string, workingSession *types.WorkingSession) error {
+	return store.write(sessionFile, workingSession, false)
+}
+
+// Only the settings and the messages without an ID are written, without looking at the
+// rest of the tree. If the session was written elsewhere since, it is saved in full.
+func (store *sqliteStore) AppendMessages(sessionFile string, workingSession *types.WorkingSession) error {
+	return store.write(sessionFile, workingSession, true)
+}
+
+func (store *sqliteStore) write(sessionFile string, workingSession *types.WorkingSession, appendOnly bool) error {
+	key := absSessionPath(sessionFile)
+	apiVersion := types.CurrentApiVersion
+	workingSession.ApiVersion = &apiVersion
+	appended := []int{}
+	for i, msg := range workingSession.Messages {
+		if msg.ID == 0 {
+			appended = append(appended, i)
+		}
+	}
+	workingSession.Sync()
+	for i := range workingSession.WorkingFiles {
+		workingSession.WorkingFiles[i].FileContent = nil
+	}
+	settings := *workingSession
+	settings.Tree = nil
+	data, err := yaml.Marshal(&settings)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	version, err := sqliteVersion(tx, key)
+	if err != nil {
+		return err
+	}
+	stored, ok := store.hashes[key]
+	if !ok || stored.version != version {
+		// Written by someone else, or not seen yet
+		if stored, err = readHashes(tx, key, version); err != nil {
+			return err
+		}
+		appendOnly = false
+	}
+
+	_, err = tx.Exec(`INSERT INTO sessions (path, version, modified, title, message_count, model, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (path) DO UPDATE SET version = excluded.version, modified = excluded.modified,
+			title = excluded.title, message_count = excluded.message_count, model = excluded.model, data = excluded.data`,
+		key, version+1, time.Now().UnixNano(), sessionTitle(workingSession), len(workingSession.Messages),
+		sessionModel(workingSession), string(data))
+	if err != nil {
+		return err
+	}
+
+	hashes := map[int]string{}
+	if appendOnly {
+		// A copy, so a failed write leaves the stored hashes as they were
+		for id, hash := range stored.hashes {
+			hashes[id] = hash
+		}
+		for _, i := range appended {
+			msg := workingSession.Messages[i]
+			if hashes[msg.ID], err = writeMessage(tx, key, msg, ""); err != nil {
+				return err
+			}
+		}
+	} else {
+		for _, msg := range workingSession.Tree {
+			if hashes[msg.ID], err = writeMessage(tx, key, msg, stored.hashes[msg.ID]); err != nil {
+				return err
+			}
+		}
+		for id := range stored.hashes {
+			if _, ok := hashes[id]; !ok {
+				if _, err := tx.Exec(`DELETE FROM messages WHERE session = ? AND id = ?`, key, id); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	store.hashes[key] = &storedHashes{version: version + 1, hashes: hashes}
+	return nil
+}
+
+// writeMessage writes a message unless it is stored with the same hash, and returns
+// its hash
+func writeMessage(tx *sql.Tx, key string, msg types.Message, storedHash string) (string, error) {
+	data, err := yaml.Marshal(&msg)
+	if err != nil {
+		return "", err
+	}
+	hash := messageHash(data)
+	if hash == storedHash {
+		return hash, nil
+	}
+	var searchText *string
+	if doc, ok := search.DocumentOf(msg); ok {
+		text := doc.SearchText()
+		searchText = &text
+	}
+	_, err = tx.Exec(`INSERT INTO messages (session, id, role, search, hash, data) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (session, id) DO UPDATE SET role = excluded.role, search = excluded.search,
+			hash = excluded.hash, data = excluded.data`,
+		key, msg.ID, msg.Role, searchText, hash, string(data))
+	return hash, err
+}
+
+// Sessions in the cir dir are listed by name, like the YAML store does, others by path
+func (store *sqliteStore) List() ([]sessionInfo, error) {
+	dir, err := filepath.Abs(store.dir)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := store.db.Query(`SELECT path, modified, title, message_count, model FROM sessions ORDER BY modified DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []sessionInfo{}
+	for rows.Next() {
+		var s sessionInfo
+		var modified int64
+		if err := rows.Scan(&s.Path, &modified, &s.Title, &s.MessageCount, &s.Model); err != nil {
+			return nil, err
+		}
+		s.Name = s.Path
+		if filepath.Dir(s.Path) == dir && filepath.Ext(s.Path) == ".yaml" {
+			s.Name = sessionName(s.Path)
+		}
+		s.ModTime = time.Unix(0, modified)
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// Search matches like the search index does, but in the database
+func (store *sqliteStore) Search(query string, limit int) ([]search.Result, error) {
+	terms := search.Terms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	conditions := []string{}
+	args := []any{}
+	for _, term := range terms {
+		conditions = append(conditions, "instr(m.search, ?) > 0")
+		args = append(args, term)
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+	args = append(args, limit)
+	rows, err := store.db.Query(`SELECT m.session, m.data, s.modified FROM messages m JOIN sessions s ON s.path = m.session
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY s.modified DESC, m.session, m.id LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []search.Result{}
+	for rows.Next() {
+		var path, data string
+		var modified int64
+		if err := rows.Scan(&path, &data, &modified); err != nil {
+			return nil, err
+		}
+		var msg types.Message
+		if err := yaml.Unmarshal([]byte(data), &msg); err != nil {
+			return nil, err
+		}
+		doc, _ := search.DocumentOf(msg)
+		results = append(results, search.Result{
+			SessionFile: path,
+			MessageID:   msg.ID,
+			Role:        msg.Role,
+			Snippet:     search.Snippet(doc, terms[0]),
+			ModTime:     time.Unix(0, modified),
+		})
+	}
+	return results, rows.Err()
+}
+
+func (store *sqliteStore) Remove(sessionFile string) error {
+	key := absSessionPath(sessionFile)
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.hashes, key)
+	_, err := store.db.Exec(`DELETE FROM sessions WHERE path = ?`, key)
+	return err
+}
+
+func (store *sqliteStore) Version(sessionFile string) (string, error) {
+	version, err := sqliteVersion(store.db, absSessionPath(sessionFile))
+	if err != nil || version == 0 {
+		return "", err
+	}
+	return strconv.FormatInt(version, 10), nil
+}
+
+func (store *sqliteStore) Close() error {
+	return store.db.Close()
+}
+
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// The version of a session, zero if it doesn't exist
+func sqliteVersion(q queryer, key string) (int64, error) {
+	var version int64
+	err := q.QueryRow(`SELECT version FROM sessions WHERE path = ?`, key).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return version, err
+}
+
+func readHashes(tx *sql.Tx, key string, version int64) (*storedHashes, error) {
+	stored := &storedHashes{version: version, hashes: map[int]string{}}
+	rows, err := tx.Query(`SELECT id, hash FROM messages WHERE session = ?`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var hash string
+		if err := rows.Scan(&id, &hash); err != nil {
+			return nil, err
+		}
+		stored.hashes[id] = hash
+	}
+	return stored, rows.Err()
+}
+
+func messageHash(data []byte) string {
+	h := fnv.New64a()
+	h.Write(data)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
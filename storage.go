@@ -1,10 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
+	"github.com/worldsayshi/cir/internal/search"
 	"github.com/worldsayshi/cir/internal/types"
 	"gopkg.in/yaml.v2"
 )
@@ -23,16 +25,13 @@ func loadWorkingSession(sessionFile string) (*types.WorkingSession, error) {
 		return nil, err
 	}
 
-	workingSession, err := types.UnmarshalWorkingSession(data)
-	if err != nil {
-		panic(err)
-	}
-	return workingSession, nil
+	return types.UnmarshalWorkingSession(data)
 }
 
 func saveWorkingSession(sessionFile string, workingSession *types.WorkingSession) error {
 	apiVersion := types.CurrentApiVersion
 	workingSession.ApiVersion = &apiVersion
+	workingSession.Sync()
 	// Strip out the file content from the working session before saving
 	for i := range workingSession.WorkingFiles {
 		workingSession.WorkingFiles[i].FileContent = nil
@@ -42,5 +41,123 @@ func saveWorkingSession(sessionFile string, workingSession *types.WorkingSession
 		return err
 	}
 
-	return os.WriteFile(sessionFile, data, 0644)
+	return writeFileAtomic(sessionFile, data, 0644)
+}
+
+// writeFileAtomic writes to a temporary file next to the target and renames it over
+// the target, so a crash leaves either the old or the new content
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Only does something if we fail before the rename
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// Make the rename itself durable
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// SessionStore is where sessions are kept. Sessions are named by their file path,
+// stores that don't keep files use the name part of it.
+type SessionStore interface {
+	// Load reads a session, creating an empty one if it doesn't exist
+	Load(sessionFile string) (*types.WorkingSession, error)
+	Save(sessionFile string, workingSession *types.WorkingSession) error
+	// AppendMessages saves a session whose messages were only added to, or branched
+	// off, since the last save. Stores may write the new messages alone.
+	AppendMessages(sessionFile string, workingSession *types.WorkingSession) error
+	// List gives the sessions, most recently modified first
+	List() ([]sessionInfo, error)
+	Search(query string, limit int) ([]search.Result, error)
+	Remove(sessionFile string) error
+	// Version changes whenever a session is written. It is empty for a missing session.
+	Version(sessionFile string) (string, error)
+	Close() error
+}
+
+const (
+	storageYAML   = "yaml"
+	storageSQLite = "sqlite"
+)
+
+// openSessionStore opens the store the config asks for, YAML files by default
+func openSessionStore(cirDir string, config *Config) (SessionStore, error) {
+	switch config.Storage {
+	case "", storageYAML:
+		return &yamlStore{dir: cirDir, searchIndex: config.SearchIndex}, nil
+	case storageSQLite:
+		return openSQLiteStore(cirDir)
+	}
+	return nil, fmt.Errorf("unknown storage %q, use %s or %s", config.Storage, storageYAML, storageSQLite)
+}
+
+// yamlStore keeps each session in a YAML file of its own
+type yamlStore struct {
+	dir string
+	// Keep a search index in the dir so searching doesn't read every session
+	searchIndex bool
+}
+
+func (store *yamlStore) Load(sessionFile string) (*types.WorkingSession, error) {
+	return loadWorkingSession(sessionFile)
+}
+
+func (store *yamlStore) Save(sessionFile string, workingSession *types.WorkingSession) error {
+	return saveWorkingSession(sessionFile, workingSession)
+}
+
+// There is no appending to a YAML file, the whole session is written
+func (store *yamlStore) AppendMessages(sessionFile string, workingSession *types.WorkingSession) error {
+	return saveWorkingSession(sessionFile, workingSession)
+}
+
+func (store *yamlStore) List() ([]sessionInfo, error) {
+	return listSessions(store.dir)
+}
+
+func (store *yamlStore) Search(query string, limit int) ([]search.Result, error) {
+	return searchSessions(store.dir, query, store.searchIndex, limit)
+}
+
+func (store *yamlStore) Remove(sessionFile string) error {
+	return os.Remove(sessionFile)
+}
+
+// The modification time and size of the file
+func (store *yamlStore) Version(sessionFile string) (string, error) {
+	stat, err := os.Stat(sessionFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", stat.ModTime().UnixNano(), stat.Size()), nil
+}
+
+func (store *yamlStore) Close() error {
+	return nil
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -124,3 +126,294 @@ working_files:
 		t.Fatalf("Expected one file, got %d", len(workingSession.WorkingFiles))
 	}
 }
+
+func TestSaveIsAtomic(t *testing.T) {
+	tmpDir := t.TempDir()
+	sessionFile := filepath.Join(tmpDir, "session.yaml")
+	if err := saveWorkingSession(sessionFile, &types.WorkingSession{InputText: "draft"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected only the session file, got %v", entries)
+	}
+}
+
+func TestSessionLock(t *testing.T) {
+	sessionFile := filepath.Join(t.TempDir(), "session.yaml")
+	lock, err := lockSession(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newChat(&yamlStore{}, sessionFile, &Config{}, nil, nil); err == nil {
+		t.Fatalf("Expected a locked session not to open")
+	}
+	lock.release()
+	c, err := newChat(&yamlStore{}, sessionFile, &Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.close()
+}
+
+func TestExternalModification(t *testing.T) {
+	sessionFile := filepath.Join(t.TempDir(), "session.yaml")
+	c, err := newChat(&yamlStore{}, sessionFile, &Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	// Someone edits the file behind our back
+	if err := os.WriteFile(sessionFile, []byte("apiVersion: v3\ninput_text: edited elsewhere\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.workingSession.InputText = "ours"
+	if err := c.save(); !errors.Is(err, errSessionModified) {
+		t.Fatalf("Expected the modification to be detected, got %v", err)
+	}
+
+	if err := c.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if c.workingSession.InputText != "edited elsewhere" {
+		t.Fatalf("Expected the edited session to be loaded, got %q", c.workingSession.InputText)
+	}
+	c.workingSession.InputText = "ours again"
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(sessionFile, []byte("apiVersion: v3\ninput_text: edited again\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.overwrite(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadWorkingSession(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.InputText != "ours again" {
+		t.Fatalf("Expected our version to be written, got %q", loaded.InputText)
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	cirDir := t.TempDir()
+	store, err := openSQLiteStore(cirDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	sessionFile := filepath.Join(cirDir, "long.yaml")
+
+	workingSession, err := store.Load(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		question := fmt.Sprintf("Question %d", i)
+		workingSession.Messages = append(workingSession.Messages,
+			types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser, Content: question}, Question: question})
+		workingSession.Messages = append(workingSession.Messages,
+			types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem, Content: fmt.Sprintf("Answer %d", i)}})
+		if err := store.AppendMessages(sessionFile, workingSession); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the new message is written
+	var before int64
+	if err := store.db.QueryRow(`SELECT max(rowid) FROM messages`).Scan(&before); err != nil {
+		t.Fatal(err)
+	}
+	workingSession.Messages = append(workingSession.Messages,
+		types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleUser, Content: "Last"}, Question: "Last"})
+	if err := store.AppendMessages(sessionFile, workingSession); err != nil {
+		t.Fatal(err)
+	}
+	var changed int
+	if err := store.db.QueryRow(`SELECT count(*) FROM messages WHERE rowid > ?`, before).Scan(&changed); err != nil {
+		t.Fatal(err)
+	}
+	if changed != 1 {
+		t.Fatalf("Expected one message to be written, got %d", changed)
+	}
+
+	// Written elsewhere in between, the whole session is saved
+	other, err := openSQLiteStore(cirDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.Save(sessionFile, &types.WorkingSession{}); err != nil {
+		t.Fatal(err)
+	}
+	workingSession.Messages = append(workingSession.Messages,
+		types.Message{AiServiceMessage: types.AiServiceMessage{Role: types.RoleSystem, Content: "Last answer"}})
+	if err := store.AppendMessages(sessionFile, workingSession); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := other.Load(sessionFile); err != nil || len(loaded.Tree) != 102 {
+		t.Fatalf("Expected the whole session to be saved, got %v", err)
+	}
+
+	// Forking and removing the old branch
+	workingSession.Fork(2)
+	workingSession.Remove(3)
+	if err := store.Save(sessionFile, workingSession); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Messages) != 2 || len(loaded.Tree) != 2 || loaded.Messages[1].Content != "Answer 0" {
+		t.Fatalf("Unexpected session after removing a branch: %v", loaded.Tree)
+	}
+
+	results, err := store.Search("answer 0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].SessionFile != sessionFile || results[0].MessageID != 2 {
+		t.Fatalf("Unexpected search results: %v", results)
+	}
+
+	sessions, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Name != "long" || sessions[0].MessageCount != 2 || sessions[0].Title != "Question 0" {
+		t.Fatalf("Unexpected session list: %v", sessions)
+	}
+}
+
+func TestSQLiteExternalModification(t *testing.T) {
+	cirDir := t.TempDir()
+	store, err := openSessionStore(cirDir, &Config{Storage: storageSQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	sessionFile := filepath.Join(cirDir, "session.yaml")
+	c, err := newChat(store, sessionFile, &Config{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	// Another cir process writes the session
+	other, err := openSQLiteStore(cirDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.Save(sessionFile, &types.WorkingSession{InputText: "edited elsewhere"}); err != nil {
+		t.Fatal(err)
+	}
+	c.workingSession.InputText = "ours"
+	if err := c.save(); !errors.Is(err, errSessionModified) {
+		t.Fatalf("Expected the modification to be detected, got %v", err)
+	}
+	if err := c.overwrite(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := other.Load(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.InputText != "ours" {
+		t.Fatalf("Expected our version to be written, got %q", loaded.InputText)
+	}
+}
+
+func TestSQLiteSessionsOfTheSameName(t *testing.T) {
+	cirDir := t.TempDir()
+	store, err := openSQLiteStore(cirDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ours := filepath.Join(cirDir, "notes.yaml")
+	other := filepath.Join(t.TempDir(), "notes.yaml")
+	if err := store.Save(ours, &types.WorkingSession{InputText: "ours"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(other, &types.WorkingSession{InputText: "other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Load(ours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.InputText != "ours" {
+		t.Fatalf("Expected the session in the cir dir, got %q", loaded.InputText)
+	}
+	sessions, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]string{}
+	for _, s := range sessions {
+		names[s.Path] = s.Name
+	}
+	if len(names) != 2 || names[ours] != "notes" || names[other] != other {
+		t.Fatalf("Unexpected session list: %v", sessions)
+	}
+}
+
+func TestSQLiteMigration(t *testing.T) {
+	cirDir := t.TempDir()
+	// A database of a cir that keyed sessions by name
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(cirDir, sqliteFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+CREATE TABLE sessions (name TEXT PRIMARY KEY, version INTEGER NOT NULL, modified INTEGER NOT NULL,
+	title TEXT NOT NULL, message_count INTEGER NOT NULL, model TEXT NOT NULL, data TEXT NOT NULL);
+CREATE TABLE messages (session TEXT NOT NULL REFERENCES sessions(name) ON DELETE CASCADE, id INTEGER NOT NULL,
+	role TEXT NOT NULL, search TEXT, hash TEXT NOT NULL, data TEXT NOT NULL, PRIMARY KEY (session, id));
+INSERT INTO sessions VALUES ('old', 1, 0, 'Hello', 1, 'gpt-4o', 'apiVersion: v4
+head: 1
+');
+INSERT INTO messages VALUES ('old', 1, 'user', 'hello', 'x', 'id: 1
+role: user
+content: Hello
+question: Hello
+');
+`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openSQLiteStore(cirDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	loaded, err := store.Load(filepath.Join(cirDir, "old.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Messages) != 1 || loaded.Messages[0].Question != "Hello" {
+		t.Fatalf("Expected the old session to be kept, got %v", loaded.Messages)
+	}
+	if err := store.Remove(filepath.Join(cirDir, "old.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	var messages int
+	if err := store.db.QueryRow(`SELECT count(*) FROM messages`).Scan(&messages); err != nil {
+		t.Fatal(err)
+	}
+	if messages != 0 {
+		t.Fatalf("Expected the messages to go with their session, %d are left", messages)
+	}
+}
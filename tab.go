@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rivo/tview"
+	"github.com/worldsayshi/cir/internal/components"
+	"github.com/worldsayshi/cir/internal/state"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+// A tab holds one session with its own history, context bar, input and stream
+type tab struct {
+	*chat
+	app         *CirApplication
+	id          int
+	chatHistory *tview.TextView
+	inputArea   *components.InputArea
+	contextBar  *components.ContextBar
+	layout      *tview.Flex
+	// Index of the question being edited into a new branch, or -1
+	editing int
+	// Stops the answer being streamed, or the last one
+	stopStream context.CancelFunc
+}
+
+func (cirApp *CirApplication) newTab(sessionFile string) (*tab, error) {
+	chat, err := newChat(cirApp.store, sessionFile, cirApp.config, cirApp.mcpClients, cirApp.spend)
+	if err != nil {
+		return nil, err
+	}
+	// The session and the widgets showing it are only touched on the UI goroutine
+	chat.update = func(change func()) { cirApp.QueueUpdateDraw(change) }
+	workingSession := chat.workingSession
+
+	var t *tab
+
+	// Chat history
+	chatHistory := components.InitChatHistory(workingSession, components.ChatHistoryHandlers{
+		Edit:         func(idx int) { t.editMessage(idx) },
+		SwitchBranch: func(idx int, delta int) { t.switchBranch(idx, delta) },
+		Info:         func(idx int) { t.showMessageInfo(idx) },
+	})
+
+	// Context bar
+	contextBar := components.NewContextBar(&workingSession.WorkingFiles)
+
+	// Text input area
+	inputArea := components.NewInputArea()
+
+	cirApp.nextTabID++
+	t = &tab{
+		chat:        chat,
+		app:         cirApp,
+		id:          cirApp.nextTabID,
+		chatHistory: chatHistory,
+		inputArea:   inputArea,
+		contextBar:  contextBar,
+		editing:     -1,
+	}
+	t.layout = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(chatHistory, 0, 5, false).
+		AddItem(contextBar, 0, 1, false).
+		AddItem(inputArea, 0, 2, true)
+	t.syncAgentTools()
+	t.subscribe()
+
+	inputArea.SetInputText(workingSession.InputText)
+
+	inputArea.SetChangedFunc(func() {
+		t.state.Dispatch(state.InputChanged{Text: inputArea.GetText()})
+		// Clearing the input cancels editing
+		if t.editing >= 0 && t.workingSession.InputText == "" {
+			t.editing = -1
+			t.renderInputTitle()
+		}
+	})
+
+	inputArea.SetSubmitFunc(t.handleChatSubmit)
+	return t, nil
+}
+
+// Render the parts of the session that change as they change
+func (t *tab) subscribe() {
+	t.state.Subscribe(state.Messages, func(s state.State) {
+		components.RenderChatHistory(t.chatHistory, s.Session)
+	})
+	t.state.Subscribe(state.Context, func(s state.State) {
+		t.contextBar.Render(s.Session.WorkingFiles)
+	})
+	t.state.Subscribe(state.Input, func(s state.State) {
+		if t.inputArea.GetText() != s.Session.InputText {
+			t.inputArea.SetInputText(s.Session.InputText)
+		}
+	})
+	t.state.Subscribe(state.Stream, func(s state.State) {
+		t.inputArea.SetDisabled(s.Streaming)
+		t.app.renderTabBar()
+		if t.app.tab == t {
+			t.app.renderStatusBar()
+		}
+	})
+	t.state.Subscribe(state.Agent, func(s state.State) {
+		t.syncAgentTools()
+	})
+}
+
+func (t *tab) pageName() string {
+	return fmt.Sprintf("tab-%d", t.id)
+}
+
+func (t *tab) streaming() bool {
+	return t.state.State().Streaming
+}
+
+// Open a session in a new tab, or go to its tab if it's already open
+func (cirApp *CirApplication) openTab(sessionFile string) error {
+	if i := cirApp.tabIndexOf(sessionFile); i >= 0 {
+		cirApp.activateTab(i)
+		return nil
+	}
+	t, err := cirApp.newTab(sessionFile)
+	if err != nil {
+		return err
+	}
+	cirApp.tabs = append(cirApp.tabs, t)
+	cirApp.tabPages.AddPage(t.pageName(), t.layout, true, false)
+	cirApp.activateTab(len(cirApp.tabs) - 1)
+	return nil
+}
+
+func (cirApp *CirApplication) tabIndexOf(sessionFile string) int {
+	for i, t := range cirApp.tabs {
+		if samePath(t.sessionFile, sessionFile) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (cirApp *CirApplication) tabIndex(tab *tab) int {
+	for i, t := range cirApp.tabs {
+		if t == tab {
+			return i
+		}
+	}
+	return -1
+}
+
+func (cirApp *CirApplication) activeTabIndex() int {
+	return cirApp.tabIndex(cirApp.tab)
+}
+
+func (cirApp *CirApplication) activateTab(i int) {
+	if i < 0 || i >= len(cirApp.tabs) {
+		return
+	}
+	cirApp.tab = cirApp.tabs[i]
+	cirApp.tabPages.SwitchToPage(cirApp.tab.pageName())
+	cirApp.renderTabBar()
+	cirApp.renderStatusBar()
+	cirApp.SetFocus(cirApp.inputArea)
+}
+
+// Move to the next tab, or the previous one if delta is negative
+func (cirApp *CirApplication) cycleTabs(delta int) {
+	n := len(cirApp.tabs)
+	cirApp.activateTab(((cirApp.activeTabIndex()+delta)%n + n) % n)
+}
+
+// Close the active tab. An answer still streaming in it is saved when done, and the
+// session is unlocked after that.
+func (cirApp *CirApplication) closeTab() {
+	if len(cirApp.tabs) == 1 {
+		return
+	}
+	i := cirApp.activeTabIndex()
+	t := cirApp.tabs[i]
+	if !t.streaming() {
+		if err := t.save(); err != nil {
+			log.Println("Error saving session:", err)
+		}
+		t.close()
+	}
+	cirApp.tabPages.RemovePage(t.pageName())
+	cirApp.tabs = append(cirApp.tabs[:i], cirApp.tabs[i+1:]...)
+	if i == len(cirApp.tabs) {
+		i--
+	}
+	cirApp.activateTab(i)
+}
+
+func (cirApp *CirApplication) renderTabBar() {
+	names := []string{}
+	for _, t := range cirApp.tabs {
+		name := sessionName(t.sessionFile)
+		if t.streaming() {
+			name += " …"
+		}
+		names = append(names, name)
+	}
+	cirApp.tabBar.Render(names, cirApp.activeTabIndex())
+}
+
+// Ask for a session name and open it in a new tab, creating it if needed
+func (cirApp *CirApplication) promptNewTab() {
+	dialog := components.NewPromptDialog("Open session in new tab", "Name", "", func(name string, ok bool) {
+		cirApp.pages.RemovePage("prompt")
+		cirApp.SetFocus(cirApp.inputArea)
+		if !ok || name == "" {
+			return
+		}
+		if err := cirApp.openTab(resolveSessionFile(cirApp.sessionsDir, name)); err != nil {
+			cirApp.showTextModal("Error", err.Error())
+		}
+	})
+	cirApp.pages.AddPage("prompt", components.Centered(dialog, 60, 7), true, true)
+	cirApp.SetFocus(dialog)
+}
+
+func (t *tab) setWorkingFiles(workingFiles []types.WorkingFile) {
+	t.state.Dispatch(state.ContextChanged{WorkingFiles: workingFiles})
+	t.saveSession()
+}
+
+func (t *tab) handleChatSubmit(text string) {
+	if text == "" {
+		return
+	}
+	t.checkSpending(func() {
+		t.submitInBackground(text, func() {
+			t.streamInBackground(completionOptions{Model: t.model()})
+		})
+	})
+}
+
+// Submit the question in a goroutine, as reading the context and running pre-submit
+// hooks may take a while. The input is locked meanwhile, as if the answer was
+// streaming already. then is called on the UI goroutine once the question is in the
+// session, what was redacted from it is shown after.
+func (t *tab) submitInBackground(text string, then func()) {
+	if t.editing >= 0 {
+		t.state.Dispatch(state.Forked{Index: t.editing})
+		t.editing = -1
+		t.renderInputTitle()
+	}
+	t.state.Dispatch(state.StreamRequested{})
+	go func() {
+		findings, err := t.submitQuestion(text, nil)
+		t.update(func() {
+			if err != nil {
+				log.Println("Error submitting question:", err)
+				t.state.Dispatch(state.StreamDone{Time: time.Now()})
+				t.app.showTextModal("Not submitted", err.Error())
+				return
+			}
+			then()
+			if len(findings) > 0 {
+				t.app.showTextModal("Redacted", formatFindings(findings))
+			}
+		})
+	}()
+}
+
+// Stream the answer in a goroutine. The input is locked from now until the stream
+// is done.
+func (t *tab) streamInBackground(options completionOptions) {
+	t.state.Dispatch(state.StreamRequested{})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.stopStream = cancel
+	go t.handleStreamResponse(ctx, cancel, options)
+}
+
+// Stop the answer being streamed, keeping what was streamed so far
+func (t *tab) stopStreaming() {
+	if t.stopStream != nil {
+		t.stopStream()
+	}
+}
+
+// Runs on its own goroutine. The stream dispatches its changes on the UI goroutine,
+// where the subscribers render them.
+func (t *tab) handleStreamResponse(ctx context.Context, cancel context.CancelFunc, options completionOptions) {
+	err := t.streamAnswer(ctx, options, func(string) {}, func() {})
+	if err != nil && ctx.Err() == nil {
+		log.Println("Error streaming answer:", err)
+	}
+	t.app.QueueUpdateDraw(func() {
+		cancel()
+		if t.app.tabIndex(t) < 0 {
+			// Closed while streaming
+			t.close()
+			return
+		}
+		if errors.Is(err, errSessionModified) {
+			t.resolveExternalChange()
+		}
+	})
+}
+
+// Save, and if the session file was changed outside this tab, let the user decide
+// what to keep
+func (t *tab) saveSession() {
+	err := t.save()
+	if err != nil {
+		log.Println("Error saving session:", err)
+	}
+	if errors.Is(err, errSessionModified) {
+		t.resolveExternalChange()
+	}
+}
+
+func (t *tab) resolveExternalChange() {
+	app := t.app
+	if app.pages.HasPage("choose") {
+		return
+	}
+	question := fmt.Sprintf("%s was changed outside this cir. Overwrite it with this tab, or reload the tab from the file?", t.sessionFile)
+	app.choose(question, []string{"Overwrite", "Reload"}, func(button string) {
+		var err error
+		if button == "Overwrite" {
+			err = t.overwrite()
+		} else if err = t.reload(); err == nil {
+			t.renderSession()
+		}
+		if err != nil {
+			app.showTextModal("Error", err.Error())
+		}
+	})
+}
+
+// Reset what isn't part of the state, after the session was replaced. The
+// subscribers render the session itself.
+func (t *tab) renderSession() {
+	t.editing = -1
+	t.renderInputTitle()
+	components.SelectMessage(t.chatHistory, -1)
+	t.app.renderTabBar()
+	if t.app.tab == t {
+		t.app.renderStatusBar()
+	}
+}
+
+func (t *tab) renderInputTitle() {
+	title := "Input"
+	if t.agentEnabled() {
+		title += " (agent)"
+	}
+	if t.editing >= 0 {
+		title += " (editing, new branch)"
+	}
+	t.inputArea.SetTitle(title)
+}
+
+// Put a past question in the input. Submitting it starts a new branch from there.
+func (t *tab) editMessage(idx int) {
+	if t.streaming() || t.workingSession.Messages[idx].Role != types.RoleUser {
+		return
+	}
+	t.editing = idx
+	t.inputArea.SetText(t.workingSession.Messages[idx].Question, true)
+	t.renderInputTitle()
+	t.app.SetFocus(t.inputArea)
+}
+
+func (t *tab) showMessageInfo(idx int) {
+	t.app.showTextModal("Message", components.MessageInfo(t.workingSession.Messages[idx]))
+}
+
+// Go to a sibling branch of the message at idx, keeping it selected
+func (t *tab) switchBranch(idx int, delta int) {
+	if t.streaming() {
+		return
+	}
+	siblings, pos := t.workingSession.Siblings(idx)
+	pos += delta
+	if pos < 0 || pos >= len(siblings) {
+		return
+	}
+	t.state.Dispatch(state.CheckedOut{MessageID: siblings[pos]})
+	t.saveSession()
+	t.editing = -1
+	t.renderInputTitle()
+	components.SelectMessage(t.chatHistory, idx)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/worldsayshi/cir/internal/hooks"
+	"github.com/worldsayshi/cir/internal/types"
+)
+
+func TestTabs(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "first.yaml")
+	second := filepath.Join(tmpDir, "second.yaml")
+
+	app := NewCirApplication(&yamlStore{}, first, &Config{}, nil)
+	if err := app.openTab(second); err != nil {
+		t.Fatal(err)
+	}
+	if len(app.tabs) != 2 || app.sessionFile != second {
+		t.Fatalf("Expected the second session to be open in a new active tab")
+	}
+
+	// Each tab has its own session and input
+	app.inputArea.SetText("second question", true)
+	app.activateTab(0)
+	if app.sessionFile != first || app.workingSession.InputText != "" {
+		t.Fatalf("Expected the first tab to keep its own session")
+	}
+	if app.tabs[1].workingSession.InputText != "second question" {
+		t.Fatalf("Expected the second tab to keep its input")
+	}
+
+	// Opening a session that is already open goes to its tab
+	if err := app.openTab(second); err != nil {
+		t.Fatal(err)
+	}
+	if len(app.tabs) != 2 || app.activeTabIndex() != 1 {
+		t.Fatalf("Expected to switch to the existing tab")
+	}
+
+	app.closeTab()
+	if len(app.tabs) != 1 || app.sessionFile != first {
+		t.Fatalf("Expected to be back on the first tab")
+	}
+	// The last tab stays open
+	app.closeTab()
+	if len(app.tabs) != 1 {
+		t.Fatalf("Expected the last tab to stay open")
+	}
+	secondSession, err := loadWorkingSession(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondSession.InputText != "second question" {
+		t.Fatalf("Expected the closed tab to be saved, got %q", secondSession.InputText)
+	}
+}
+
+// startApp runs the app on a simulated screen until the test ends
+func startApp(t *testing.T, app *CirApplication) tcell.SimulationScreen {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	app.SetScreen(screen)
+	done := make(chan struct{})
+	go func() {
+		app.Run()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		app.Stop()
+		<-done
+	})
+	return screen
+}
+
+// waitFor checks cond on the UI goroutine until it holds
+func waitFor(t *testing.T, app *CirApplication, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		var ok bool
+		// Returns after cond was checked
+		app.QueueUpdate(func() { ok = cond() })
+		if ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+// Start a test app on a new session with a scripted provider
+func scriptedApp(t *testing.T, fake *scripted) (*CirApplication, string) {
+	sessionFile := filepath.Join(t.TempDir(), "session.yaml")
+	app := NewCirApplication(&yamlStore{}, sessionFile, &Config{}, nil)
+	app.tab.provider = fake
+	return app, sessionFile
+}
+
+func lastAnswer(t *testing.T, sessionFile string) types.Message {
+	loaded, err := loadWorkingSession(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Messages) != 2 {
+		t.Fatalf("Expected a question and an answer, got %v", loaded.Messages)
+	}
+	return loaded.Messages[1]
+}
+
+func TestSubmitStreamsAnswer(t *testing.T) {
+	fake := newScripted(chunks("Hello", " there"))
+	app, sessionFile := scriptedApp(t, fake)
+	startApp(t, app)
+
+	app.QueueUpdate(func() { app.handleChatSubmit("Hi") })
+	waitFor(t, app, "the answer", func() bool {
+		return !app.streaming() && len(app.workingSession.Messages) == 2
+	})
+
+	answer := lastAnswer(t, sessionFile)
+	if answer.Content != "Hello there" || answer.Provider != scriptedProvider {
+		t.Fatalf("Expected the scripted answer to be saved, got %+v", answer)
+	}
+	if answer.Usage == nil || answer.Usage.CompletionTokens != 2 {
+		t.Fatalf("Expected the usage to be saved, got %v", answer.Usage)
+	}
+	if len(fake.requests) != 1 || !strings.Contains(fake.requests[0][0].Content, "Hi") {
+		t.Fatalf("Expected the question to be sent, got %v", fake.requests)
+	}
+}
+
+// A hook that holds on to the payload until the test releases it, then prints output
+func heldHook(dir string, output string) hooks.Hook {
+	script := fmt.Sprintf(`cat > /dev/null; touch %[1]s/started; while [ ! -e %[1]s/release ]; do sleep 0.01; done; echo '%[2]s'`, dir, output)
+	return hooks.Hook{Command: "bash", Args: []string{"-c", script}}
+}
+
+// Wait for a held hook to start, check that the UI goes on meanwhile and release it
+func releaseHeldHook(t *testing.T, app *CirApplication, dir string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for _, err := os.Stat(filepath.Join(dir, "started")); err != nil; _, err = os.Stat(filepath.Join(dir, "started")) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the hook")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The UI isn't blocked by the hook, and shows that something is going on
+	waitFor(t, app, "the UI", func() bool { return app.streaming() })
+	if err := os.WriteFile(filepath.Join(dir, "release"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPreSubmitHookOffUIGoroutine(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{Hooks: hooks.Config{PreSubmit: []hooks.Hook{heldHook(dir, `{"payload": {"question": "Rewritten"}}`)}}}
+	sessionFile := filepath.Join(dir, "session.yaml")
+	app := NewCirApplication(&yamlStore{}, sessionFile, config, nil)
+	app.tab.provider = newScripted(chunks("Hello"))
+	startApp(t, app)
+
+	app.QueueUpdate(func() { app.handleChatSubmit("Hi") })
+	releaseHeldHook(t, app, dir)
+	waitFor(t, app, "the answer", func() bool { return !app.streaming() && len(app.workingSession.Messages) == 2 })
+	loaded, err := loadWorkingSession(sessionFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Messages[0].Question != "Rewritten" {
+		t.Fatalf("Expected the hook to rewrite the question, got %q", loaded.Messages[0].Question)
+	}
+}
+
+func TestPostResponseHookOffUIGoroutine(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{Hooks: hooks.Config{PostResponse: []hooks.Hook{heldHook(dir, `{"payload": {"response": "Rewritten"}}`)}}}
+	sessionFile := filepath.Join(dir, "session.yaml")
+	app := NewCirApplication(&yamlStore{}, sessionFile, config, nil)
+	app.tab.provider = newScripted(chunks("Hello"))
+	startApp(t, app)
+
+	app.QueueUpdate(func() { app.handleChatSubmit("Hi") })
+	releaseHeldHook(t, app, dir)
+	waitFor(t, app, "the rewritten answer", func() bool { return !app.streaming() })
+	if answer := lastAnswer(t, sessionFile); answer.Content != "Rewritten" {
+		t.Fatalf("Expected the hook to rewrite the answer, got %q", answer.Content)
+	}
+}
+
+func TestStopStreaming(t *testing.T) {
+	fake := newScripted([]streamEvent{{Chunk: "Hel"}, {Delay: time.Hour, Chunk: "lo"}})
+	app, sessionFile := scriptedApp(t, fake)
+	screen := startApp(t, app)
+
+	app.QueueUpdate(func() { app.handleChatSubmit("Hi") })
+	waitFor(t, app, "the first chunk", func() bool {
+		messages := app.workingSession.Messages
+		return len(messages) == 2 && messages[1].Content == "Hel"
+	})
+	screen.InjectKey(tcell.KeyRune, 'x', tcell.ModAlt)
+	waitFor(t, app, "the stream to stop", func() bool { return !app.streaming() })
+
+	if answer := lastAnswer(t, sessionFile); answer.Content != "Hel" {
+		t.Fatalf("Expected what was streamed before stopping to be kept, got %q", answer.Content)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	fake := newScripted([]streamEvent{{err: &apiError{kind: errRateLimited, StatusCode: 429, Message: "slow down"}}})
+	app, sessionFile := scriptedApp(t, fake)
+	startApp(t, app)
+
+	app.QueueUpdate(func() { app.handleChatSubmit("Hi") })
+	waitFor(t, app, "the error", func() bool {
+		return !app.streaming() && len(app.workingSession.Messages) == 2
+	})
+
+	answer := lastAnswer(t, sessionFile)
+	if !strings.HasPrefix(answer.Content, "Error: rate limited (429): slow down") {
+		t.Fatalf("Expected the error in the answer, got %q", answer.Content)
+	}
+	// The input is unlocked for another try
+	waitFor(t, app, "the input", func() bool { return !app.inputArea.GetDisabled() })
+}
+
+// Run with -race: the answer streams into one tab while keys are typed in another and
+// the history of the streaming tab is browsed
+func TestStreamWhileTyping(t *testing.T) {
+	script := []streamEvent{}
+	for i := 0; i < 50; i++ {
+		script = append(script, streamEvent{Delay: time.Millisecond, Chunk: "word "})
+	}
+	app, sessionFile := scriptedApp(t, newScripted(script))
+	if err := app.openTab(filepath.Join(filepath.Dir(sessionFile), "second.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	app.activateTab(0)
+	screen := startApp(t, app)
+
+	app.QueueUpdate(func() { app.handleChatSubmit("Hi") })
+	screen.InjectKey(tcell.KeyRune, '2', tcell.ModAlt)
+	for _, r := range "next question" {
+		screen.InjectKey(tcell.KeyRune, r, tcell.ModNone)
+	}
+	screen.InjectKey(tcell.KeyRune, '1', tcell.ModAlt)
+	screen.InjectKey(tcell.KeyTab, 0, tcell.ModNone)
+	for i := 0; i < 5; i++ {
+		screen.InjectKey(tcell.KeyRune, 'p', tcell.ModNone)
+		screen.InjectKey(tcell.KeyRune, 'n', tcell.ModNone)
+	}
+
+	first, second := app.tabs[0], app.tabs[1]
+	waitFor(t, app, "the answer", func() bool {
+		return !first.streaming() && len(first.workingSession.Messages) == 2
+	})
+	waitFor(t, app, "the typed input", func() bool { return second.workingSession.InputText == "next question" })
+	if answer := lastAnswer(t, sessionFile); answer.Content != strings.Repeat("word ", 50) {
+		t.Fatalf("Expected the whole answer, got %q", answer.Content)
+	}
+}
+
+// The input keeps tview's editing keys, the app doesn't take them
+func TestInputEditingKeys(t *testing.T) {
+	app, sessionFile := scriptedApp(t, newScripted(nil))
+	if err := app.openTab(filepath.Join(filepath.Dir(sessionFile), "second.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	screen := startApp(t, app)
+
+	for _, r := range "one two" {
+		screen.InjectKey(tcell.KeyRune, r, tcell.ModNone)
+	}
+	// Delete a word
+	screen.InjectKey(tcell.KeyCtrlW, 0, tcell.ModCtrl)
+	waitFor(t, app, "the word to be deleted", func() bool { return app.inputArea.GetText() == "one " })
+	// Select all and cut
+	screen.InjectKey(tcell.KeyCtrlL, 0, tcell.ModCtrl)
+	screen.InjectKey(tcell.KeyCtrlX, 0, tcell.ModCtrl)
+	waitFor(t, app, "the text to be cut", func() bool { return app.inputArea.GetText() == "" })
+	waitFor(t, app, "both tabs", func() bool { return len(app.tabs) == 2 && !app.modalOpen() })
+
+	screen.InjectKey(tcell.KeyRune, 'w', tcell.ModAlt)
+	waitFor(t, app, "the tab to close", func() bool { return len(app.tabs) == 1 })
+}